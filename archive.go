@@ -0,0 +1,192 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"fmt"
+	htpl "html/template"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sections with Archive set get date archives, rendered with the style's
+// templates:
+//
+//	<section>/archive   archive.html, every item grouped by year and month
+//	<section>/2015/     year.html
+//	<section>/2015/03/  month.html
+//
+// Items without a year are left out.
+type archiveContext struct {
+	Years   []*yearContext
+	Section *sectionContext
+}
+
+type yearContext struct {
+	Year    int
+	Months  []*monthContext
+	Items   []*itemContext
+	Section *sectionContext
+}
+
+type monthContext struct {
+	Year    int
+	Month   int
+	Items   []*itemContext
+	Section *sectionContext
+}
+
+func archiveURL(s *sectionContext, p string) string {
+	return RelURL(path.Join(s.Dir, p))
+}
+
+func (a *archiveContext) AbsoluteURL() string {
+	return archiveURL(a.Section, "archive")
+}
+func (a *archiveContext) PageTitle() string {
+	return "Archive - " + a.Section.Title
+}
+func (a *archiveContext) FeedURL() string {
+	return a.Section.FeedURL()
+}
+func (a *archiveContext) HomeURL() string {
+	return a.Section.HomeURL()
+}
+func (a *archiveContext) RootURL() string {
+	return a.Section.RootURL()
+}
+func (a *archiveContext) HomeTitle() string {
+	return a.Section.HomeTitle()
+}
+func (a *archiveContext) Include() htpl.HTML {
+	return a.Section.Include()
+}
+func (a *archiveContext) GoPath() string {
+	return ""
+}
+
+func (y *yearContext) AbsoluteURL() string {
+	return archiveURL(y.Section, fmt.Sprintf("%04d", y.Year)) + "/"
+}
+func (y *yearContext) PageTitle() string {
+	return fmt.Sprintf("%d - %s", y.Year, y.Section.Title)
+}
+func (y *yearContext) FeedURL() string {
+	return y.Section.FeedURL()
+}
+func (y *yearContext) HomeURL() string {
+	return y.Section.HomeURL()
+}
+func (y *yearContext) RootURL() string {
+	return y.Section.RootURL()
+}
+func (y *yearContext) HomeTitle() string {
+	return y.Section.HomeTitle()
+}
+func (y *yearContext) Include() htpl.HTML {
+	return y.Section.Include()
+}
+func (y *yearContext) GoPath() string {
+	return ""
+}
+
+func (m *monthContext) MonthName() string {
+	return time.Month(m.Month).String()
+}
+func (m *monthContext) AbsoluteURL() string {
+	return archiveURL(m.Section, fmt.Sprintf("%04d/%02d", m.Year, m.Month)) + "/"
+}
+func (m *monthContext) PageTitle() string {
+	return fmt.Sprintf("%s %d - %s", m.MonthName(), m.Year, m.Section.Title)
+}
+func (m *monthContext) FeedURL() string {
+	return m.Section.FeedURL()
+}
+func (m *monthContext) HomeURL() string {
+	return m.Section.HomeURL()
+}
+func (m *monthContext) RootURL() string {
+	return m.Section.RootURL()
+}
+func (m *monthContext) HomeTitle() string {
+	return m.Section.HomeTitle()
+}
+func (m *monthContext) Include() htpl.HTML {
+	return m.Section.Include()
+}
+func (m *monthContext) GoPath() string {
+	return ""
+}
+
+// contextFromArchive groups the items of s by year and month, latest first.
+func contextFromArchive(s *sectionContext) *archiveContext {
+	years := make(map[int]map[int][]*item)
+	for _, i := range s.section.items {
+		if i.Year == 0 {
+			continue
+		}
+		if years[i.Year] == nil {
+			years[i.Year] = make(map[int][]*item)
+		}
+		years[i.Year][i.Month] = append(years[i.Year][i.Month], i)
+	}
+	sortKeys := strings.Split(s.section.IndexSort, ",")
+	toContext := func(items []*item) []*itemContext {
+		SortItemsBy(items, sortKeys...)
+		var is []*itemContext
+		for _, i := range items {
+			is = append(is, contextFromItem(i, s))
+		}
+		return is
+	}
+	a := &archiveContext{Section: s}
+	for y, months := range years {
+		yctx := &yearContext{Year: y, Section: s}
+		var all []*item
+		for m, items := range months {
+			all = append(all, items...)
+			if m == 0 {
+				continue
+			}
+			yctx.Months = append(yctx.Months, &monthContext{Year: y, Month: m, Items: toContext(items), Section: s})
+		}
+		sort.Slice(yctx.Months, func(i, j int) bool { return yctx.Months[i].Month > yctx.Months[j].Month })
+		yctx.Items = toContext(all)
+		a.Years = append(a.Years, yctx)
+	}
+	sort.Slice(a.Years, func(i, j int) bool { return a.Years[i].Year > a.Years[j].Year })
+	return a
+}
+
+// outputArchives writes the archive pages of s and returns their URLs.
+func outputArchives(s *sectionContext) []string {
+	a := contextFromArchive(s)
+	dir := filepath.Join(buildDir, s.Dir)
+	outputTemplate("archive.html", filepath.Join(dir, "archive.html"), s.section, a)
+	urls := []string{a.AbsoluteURL()}
+	for _, y := range a.Years {
+		outputTemplate("year.html", filepath.Join(dir, fmt.Sprintf("%04d", y.Year), "index.html"), s.section, y)
+		urls = append(urls, y.AbsoluteURL())
+		for _, m := range y.Months {
+			outputTemplate("month.html", filepath.Join(dir, fmt.Sprintf("%04d", m.Year), fmt.Sprintf("%02d", m.Month), "index.html"), s.section, m)
+			urls = append(urls, m.AbsoluteURL())
+		}
+	}
+	return urls
+}
@@ -0,0 +1,119 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	staticDir = "static"
+	hashLen   = 6
+)
+
+// assetManifest maps the name of a static file, relative to its static
+// directory, to the URL of its fingerprinted copy.
+type assetManifest map[string]string
+
+var (
+	siteAssets  = make(assetManifest)
+	styleAssets = make(map[string]assetManifest)
+	// modification time of the newest static file, pages older than this must
+	// be rendered again since asset URLs may have changed.
+	assetsModTime time.Time
+)
+
+func hashBytes(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])[:hashLen]
+}
+
+// fingerprintName turns css/style.css into css/style.3fa2c1.css
+func fingerprintName(name, hash string) string {
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+func copyStaticDir(dir, outdir string) assetManifest {
+	m := make(assetManifest)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return m
+	}
+	err := filepath.Walk(dir, func(f string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, f)
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(assetsModTime) {
+			assetsModTime = info.ModTime()
+		}
+		// read once, both to hash and to copy
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		out := filepath.Join(outdir, fingerprintName(rel, hashBytes(b)))
+		recordOutput(out, f)
+		if newer(f, out) {
+			copyTo(out, bytes.NewReader(b), info)
+		}
+		m[filepath.ToSlash(rel)] = RelURL(strings.TrimPrefix(out, buildDir))
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return m
+}
+
+// copyStatic copies the site's static directory and the static directory of
+// every style used, fingerprinting file names.
+func copyStatic() {
+	siteAssets = copyStaticDir(filepath.Join(cfgDir, staticDir), filepath.Join(buildDir, staticDir))
+	for _, style := range usedStyles() {
+		styleAssets[style] = copyStaticDir(stylePath(style)+staticDir, filepath.Join(buildDir, stylesDir, style))
+	}
+}
+
+// assetFunc returns the `asset' template function for style. Files from the
+// style's static directory shadow the site's ones.
+func assetFunc(style string) func(string) string {
+	return func(name string) string {
+		name = strings.TrimPrefix(name, "/")
+		if u, ok := styleAssets[style][name]; ok {
+			return u
+		}
+		if u, ok := siteAssets[name]; ok {
+			return u
+		}
+		log.Fatalf("asset %q not found (style %q)", name, style)
+		return ""
+	}
+}
@@ -0,0 +1,241 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// A style is bundled if its directory contains bundleName. CSS and JS list
+// the files to concatenate, in order. When empty every *.css (*.js) file of
+// the style is taken in alphabetical order.
+//
+//	css: [reset.css, style.css]
+//	js: [jquery.js, main.js]
+//	minify: true
+const bundleName = "bundle.yaml"
+
+type bundle struct {
+	CSS    []string
+	JS     []string
+	Minify bool
+
+	cssURL string
+	jsURL  string
+}
+
+var styleBundles = make(map[string]*bundle)
+
+// bundlesState lists, inside the build directory, the bundle URLs of the
+// last build. Bundle names change with their content and with --dev, and
+// pages linking them must then be rendered again.
+const bundlesState = ".bundles"
+
+func readBundle(style string) *bundle {
+	buf, err := ioutil.ReadFile(stylePath(style) + bundleName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		log.Fatal(err)
+	}
+	b := &bundle{}
+	err = yaml.Unmarshal(buf, b)
+	if err != nil {
+		log.Fatalf("%s: %v", stylePath(style)+bundleName, err)
+	}
+	return b
+}
+
+func bundleFiles(style string, names []string, ext string) []string {
+	if len(names) == 0 {
+		fs, err := filepath.Glob(stylePath(style) + "*" + ext)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sort.Strings(fs)
+		return fs
+	}
+	var fs []string
+	for _, n := range names {
+		fs = append(fs, stylePath(style)+n)
+	}
+	return fs
+}
+
+// vlq encodes n as a base64 VLQ, as used by source maps.
+func vlq(n int) string {
+	const b64 = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+	v := n << 1
+	if n < 0 {
+		v = (-n << 1) | 1
+	}
+	s := ""
+	for {
+		d := v & 31
+		v >>= 5
+		if v > 0 {
+			d |= 32
+		}
+		s += string(b64[d])
+		if v == 0 {
+			return s
+		}
+	}
+}
+
+// sourceMap maps each line of a concatenation to the line of the file it came from.
+type sourceMap struct {
+	Version  int      `json:"version"`
+	File     string   `json:"file"`
+	Sources  []string `json:"sources"`
+	Mappings string   `json:"mappings"`
+
+	mappings []string
+	src      int
+	line     int
+}
+
+func (m *sourceMap) addFile(name string, lines int) {
+	m.Sources = append(m.Sources, name)
+	src := len(m.Sources) - 1
+	for l := 0; l < lines; l++ {
+		m.mappings = append(m.mappings, "A"+vlq(src-m.src)+vlq(l-m.line)+"A")
+		m.src, m.line = src, l
+	}
+}
+
+func (m *sourceMap) addLines(lines int) {
+	for l := 0; l < lines; l++ {
+		m.mappings = append(m.mappings, "")
+	}
+}
+
+// writeBundle concatenates fs and writes the result inside outdir. It returns
+// the URL of the bundle.
+func writeBundle(fs []string, outdir, ext string, minify bool) string {
+	if len(fs) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	sm := &sourceMap{Version: 3}
+	for _, f := range fs {
+		st, err := os.Stat(f)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if st.ModTime().After(assetsModTime) {
+			assetsModTime = st.ModTime()
+		}
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(b) > 0 && b[len(b)-1] != '\n' {
+			b = append(b, '\n')
+		}
+		buf.Write(b)
+		sm.addFile(filepath.Base(f), bytes.Count(b, []byte("\n")))
+		if ext == ".js" {
+			buf.WriteString(";\n")
+			sm.addLines(1)
+		}
+	}
+
+	out := buf.Bytes()
+	if minify && !*flagDev {
+		if ext == ".css" {
+			out = minifyCSS(out)
+		} else {
+			out = minifyJS(out)
+		}
+	}
+	name := fingerprintName("bundle"+ext, hashBytes(out))
+	if *flagDev {
+		sm.File = name
+		sm.Mappings = strings.Join(sm.mappings, ";")
+		j, err := json.Marshal(sm)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeFile(filepath.Join(outdir, name+".map"), j)
+		if ext == ".css" {
+			out = append(out, "/*# sourceMappingURL="+name+".map */\n"...)
+		} else {
+			out = append(out, "//# sourceMappingURL="+name+".map\n"...)
+		}
+	}
+	p := filepath.Join(outdir, name)
+	writeFile(p, out)
+	return RelURL(strings.TrimPrefix(p, buildDir))
+}
+
+// bundleStyles writes the CSS and JS bundles of every style which asks for it.
+func bundleStyles() {
+	for _, style := range usedStyles() {
+		b := readBundle(style)
+		styleBundles[style] = b
+		if b == nil {
+			continue
+		}
+		if st, err := os.Stat(stylePath(style) + bundleName); err == nil && st.ModTime().After(assetsModTime) {
+			assetsModTime = st.ModTime()
+		}
+		b.cssURL = writeBundle(bundleFiles(style, b.CSS, ".css"), filepath.Join(buildDir, "css", style), ".css", b.Minify)
+		b.jsURL = writeBundle(bundleFiles(style, b.JS, ".js"), filepath.Join(buildDir, "js", style), ".js", b.Minify)
+	}
+	checkBundlesState()
+}
+
+// checkBundlesState marks every page as stale if a bundle URL changed since
+// the last build.
+func checkBundlesState() {
+	var styles []string
+	for style, b := range styleBundles {
+		if b != nil {
+			styles = append(styles, style)
+		}
+	}
+	sort.Strings(styles)
+	var state bytes.Buffer
+	for _, style := range styles {
+		state.WriteString(style + " " + styleBundles[style].cssURL + " " + styleBundles[style].jsURL + "\n")
+	}
+	p := filepath.Join(buildDir, bundlesState)
+	old, err := ioutil.ReadFile(p)
+	if err == nil && bytes.Equal(old, state.Bytes()) {
+		return
+	}
+	assetsModTime = time.Now()
+	err = os.MkdirAll(buildDir, 0755)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = ioutil.WriteFile(p, state.Bytes(), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
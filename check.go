@@ -0,0 +1,225 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// outputs maps every file written (or that would have been written if not up
+// to date) inside buildDir to what produced it.
+var outputs = struct {
+	sync.Mutex
+	m map[string]string
+}{m: make(map[string]string)}
+
+// recordOutput remembers that p was produced by src. An empty src doesn't
+// overwrite an already known one.
+func recordOutput(p, src string) {
+	outputs.Lock()
+	defer outputs.Unlock()
+	p = filepath.Clean(p)
+	if old, ok := outputs.m[p]; ok && src == "" {
+		src = old
+	}
+	outputs.m[p] = src
+}
+
+// producerOf returns what produced p, if p was already recorded.
+func producerOf(p string) (string, bool) {
+	outputs.Lock()
+	defer outputs.Unlock()
+	src, ok := outputs.m[filepath.Clean(p)]
+	return src, ok
+}
+
+var anchorRe = regexp.MustCompile(`(?i)\s(?:id|name)\s*=\s*["']?([^"'\s>]+)`)
+
+// htmlStartTags returns the start tags of the HTML page b, skipping comments
+// and the content of scripts and styles.
+func htmlStartTags(b []byte) [][]byte {
+	var tags [][]byte
+	for i := 0; i < len(b); {
+		if bytes.HasPrefix(b[i:], []byte("<!--")) {
+			end := bytes.Index(b[i:], []byte("-->"))
+			if end < 0 {
+				break
+			}
+			i += end + 3
+			continue
+		}
+		if b[i] != '<' || i+1 == len(b) || !(b[i+1] >= 'a' && b[i+1] <= 'z' || b[i+1] >= 'A' && b[i+1] <= 'Z') {
+			i++
+			continue
+		}
+		j := htmlTagEnd(b, i)
+		tags = append(tags, b[i:j])
+		name, _ := htmlTagName(b[i:j])
+		i = j
+		if name == "script" || name == "style" {
+			k := indexFold(b[i:], "</"+name)
+			if k < 0 {
+				break
+			}
+			i += k
+		}
+	}
+	return tags
+}
+
+// pageURL returns the URL path under which the output p is served.
+func pageURL(p string) string {
+	return RelURL(strings.TrimSuffix(filepath.ToSlash(strings.TrimPrefix(p, buildDir)), ".html"))
+}
+
+// resolveOutput returns the output served at the URL path u, if any.
+func resolveOutput(u string) (string, bool) {
+	var rel string
+	switch {
+	case u+"/" == Config.BasePath:
+	case strings.HasPrefix(u, Config.BasePath):
+		rel = u[len(Config.BasePath):]
+	default:
+		return "", false
+	}
+	p := filepath.Join(buildDir, rel)
+	for _, c := range []string{p, p + ".html", filepath.Join(p, "index.html")} {
+		if _, ok := outputs.m[c]; ok {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+type linkChecker struct {
+	anchors map[string]map[string]bool
+	broken  []string
+}
+
+func (c *linkChecker) pageAnchors(p string) map[string]bool {
+	if a, ok := c.anchors[p]; ok {
+		return a
+	}
+	a := make(map[string]bool)
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, t := range htmlStartTags(b) {
+		for _, m := range anchorRe.FindAllSubmatch(t, -1) {
+			a[html.UnescapeString(string(m[1]))] = true
+		}
+	}
+	c.anchors[p] = a
+	return a
+}
+
+func (c *linkChecker) report(p, link, why string) {
+	src := outputs.m[p]
+	if src == "" {
+		src = p
+	}
+	c.broken = append(c.broken, fmt.Sprintf("%s: %q: %s", src, link, why))
+}
+
+func (c *linkChecker) checkPage(p string) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		log.Fatal(err)
+	}
+	base, err := url.Parse(pageURL(p))
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, t := range htmlStartTags(b) {
+		for _, m := range linkAttrRe.FindAllSubmatch(t, -1) {
+			c.checkLink(p, base, html.UnescapeString(string(m[2])))
+		}
+	}
+}
+
+func (c *linkChecker) checkLink(p string, base *url.URL, link string) {
+	u, err := url.Parse(link)
+	if err != nil {
+		c.report(p, link, err.Error())
+		return
+	}
+	if u.Scheme != "" || u.Host != "" || u.Opaque != "" {
+		return
+	}
+	target := p
+	if u.Path != "" {
+		var ok bool
+		target, ok = resolveOutput(path.Clean(base.ResolveReference(u).Path))
+		if !ok {
+			c.report(p, link, "no such page")
+			return
+		}
+	}
+	if u.Fragment != "" && strings.HasSuffix(target, ".html") && !c.pageAnchors(target)[u.Fragment] {
+		c.report(p, link, "no such anchor")
+	}
+}
+
+// checkLinks checks every internal link of the HTML pages produced.
+func checkLinks() bool {
+	c := &linkChecker{anchors: make(map[string]map[string]bool)}
+	var pages []string
+	for p := range outputs.m {
+		if strings.HasSuffix(p, ".html") {
+			pages = append(pages, p)
+		}
+	}
+	sort.Strings(pages)
+	for _, p := range pages {
+		c.checkPage(p)
+	}
+	for _, b := range c.broken {
+		fmt.Println(b)
+	}
+	return len(c.broken) == 0
+}
+
+// check runs the `check' command, it's called after the site has been built.
+func check(args []string) {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	links := fs.Bool("links", false, "report broken internal links and anchors")
+	fs.Parse(args)
+	if !*links {
+		fs.Usage()
+		os.Exit(2)
+	}
+	ok := true
+	if *links {
+		ok = checkLinks() && ok
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,42 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTMLStartTags(t *testing.T) {
+	tests := []struct {
+		in   string
+		tags []string
+	}{
+		{`<p id="a">x</p><a href="#a">y</a>`, []string{`<p id="a">`, `<a href="#a">`}},
+		{`<!-- <a href="x"> --><b>`, []string{`<b>`}},
+		{`<script>var s = "<a href='x'>";</script><i>`, []string{`<script>`, `<i>`}},
+		{`İİİİİİ<style>a{}</STYLE><a id="z">`, []string{`<style>`, `<a id="z">`}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, tag := range htmlStartTags([]byte(tt.in)) {
+			got = append(got, string(tag))
+		}
+		if strings.Join(got, " ") != strings.Join(tt.tags, " ") {
+			t.Errorf("htmlStartTags(%q) = %q, want %q", tt.in, got, tt.tags)
+		}
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	htpl "html/template"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
@@ -34,11 +35,15 @@ func openBuf(i *item) {
 	if i.src != nil {
 		log.Fatalf("trying to reopen %q\n", i.inpath)
 	}
-	f, err := os.Open(i.inpath)
-	if err != nil {
-		log.Fatal(err)
+	if i.r.generated() {
+		i.src = ioutil.NopCloser(bytes.NewReader(i.content))
+	} else {
+		f, err := os.Open(srcPath(i.inpath))
+		if err != nil {
+			log.Fatal(err)
+		}
+		i.src = f
 	}
-	i.src = f
 	i.buf = bufio.NewReader(i.src)
 }
 
@@ -54,15 +59,34 @@ func closeBuf(i *item) {
 	i.buf = nil
 }
 
-// FIXME: use buffer inside itemContext
+// GetBody renders the body of i. The result is cached, so GetBody can be
+// called more than once (e.g. by TOC and by the template).
 func GetBody(i *item) htpl.HTML {
+	if i.rendered {
+		return htpl.HTML(i.body)
+	}
 	defer closeBuf(i)
 	if i.src == nil {
 		openBuf(i)
 	}
+	src, err := ioutil.ReadAll(i.buf)
+	if err != nil {
+		log.Fatalf("%s: %v", i.inpath, err)
+	}
+	src = expandRefs(i, expandShortcodes(i, src))
+	var blocks []*codeBlock
+	if i.r.s.Highlight {
+		src, blocks = extractCodeBlocks(i, src)
+	}
 	var buf bytes.Buffer
-	execShellIO(i.r.Exec, i.buf, &buf, nil)
-	return htpl.HTML(buf.String())
+	if i.r.Exec == "" {
+		buf.Write(src)
+	} else {
+		execShellIO(i.r.Exec, bytes.NewReader(src), &buf, nil)
+	}
+	i.body = addHeadingIDs(restoreCodeBlocks(i, buf.Bytes(), blocks), false)
+	i.rendered = true
+	return htpl.HTML(i.body)
 }
 
 func metaFromPath(i *item) {
@@ -149,6 +173,7 @@ func metaFromHeader(i *item) {
 	if err != nil {
 		log.Fatalf("%s: %v", i.inpath, err)
 	}
+	termsFromHeader(i, h)
 }
 
 func metaInfer(i *item) {
@@ -185,9 +210,19 @@ func fileToItem(f string, r *rule) *item {
 	i.inpath = f
 	i.r = r
 	i.User = make(map[string]interface{})
+	i.terms = make(map[string][]string)
 	metaFromPath(i)
 	metaFromHeader(i)
+	return completeItem(i)
+}
+
+// completeItem infers what's missing from the metadata of i and computes its
+// output path.
+func completeItem(i *item) *item {
 	metaInfer(i)
+	if i.Title == "" && i.GoPath != "" {
+		i.Title = i.GoPath
+	}
 
 	// FIXME
 	if i.r.NoHeader == false {
@@ -227,18 +262,42 @@ func collectItem(f string, info os.FileInfo, err error) error {
 	if err != nil {
 		return err
 	}
+	f, err = filepath.Rel(srcDir, f)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		if f != "." && ignoredDir(f) {
+			return filepath.SkipDir
+		}
+		loadIgnoreFiles(f)
+		if collectBundle(f) {
+			return filepath.SkipDir
+		}
+		return nil
+	}
 	if !info.Mode().IsRegular() {
 		return nil
 	}
+	if siteIgnore.ignored(f, false) {
+		return nil
+	}
+	rel := f
 	for _, s := range AllSections {
+		if s.ignore.ignored(rel, false) {
+			continue
+		}
 		if s.Dir == "." && strings.IndexByte(f, '/') == -1 {
 			f = "./" + f
 		}
 		for _, r := range s.Rules {
+			if r.generated() {
+				continue
+			}
 			if r.inre.MatchString(f) {
 				i := fileToItem(f, r)
 				if r.copy {
-					copyFile(i.inpath, i.outpath)
+					copyFile(srcPath(i.inpath), i.outpath)
 				} else {
 					s.items = append(s.items, i)
 				}
@@ -259,8 +318,9 @@ func collectItem(f string, info os.FileInfo, err error) error {
 }
 
 func collectItems() {
-	err := filepath.Walk(".", collectItem)
+	err := filepath.Walk(srcDir, collectItem)
 	if err != nil {
 		log.Fatal(err)
 	}
+	generateItems()
 }
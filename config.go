@@ -18,6 +18,9 @@ package main
 import (
 	"io/ioutil"
 	"log"
+	"os"
+	"path"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"text/template"
@@ -25,7 +28,7 @@ import (
 	yaml "gopkg.in/yaml.v2"
 )
 
-const (
+var (
 	cfgDir  = "_formica"
 	cfgName = "config.yaml"
 )
@@ -65,8 +68,68 @@ func pathToTpl(out, dir string) *template.Template {
 	return tpl
 }
 
+func cleanBasePath(p string) string {
+	p = path.Clean("/" + p)
+	if p != "/" {
+		p += "/"
+	}
+	return p
+}
+
+func absPath(p string) string {
+	p, err := filepath.Abs(p)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return p
+}
+
+// setupRoots decides where the sources, the configuration and the output live.
+// Command line flags win over the configuration file, relative paths found
+// in the configuration file are relative to the directory containing cfgDir.
+func setupRoots(source, destination string) {
+	rel := func(p string) string {
+		if filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(filepath.Dir(cfgDir), p)
+	}
+
+	if *flagSource != "" {
+		srcDir = *flagSource
+	} else if source != "" {
+		srcDir = rel(source)
+	}
+	srcDir = absPath(srcDir)
+
+	switch {
+	case *flagDestination != "":
+		buildDir = *flagDestination
+	case destination != "":
+		buildDir = rel(destination)
+	default:
+		buildDir = filepath.Join(srcDir, buildDir)
+	}
+	buildDir = absPath(buildDir) + "/"
+}
+
 func parseConfig() {
-	buf, err := ioutil.ReadFile(cfgDir + "/" + cfgName)
+	if *flagConfig != "" {
+		fi, err := os.Stat(*flagConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if fi.IsDir() {
+			cfgDir = *flagConfig
+		} else {
+			cfgDir, cfgName = filepath.Split(*flagConfig)
+		}
+	} else {
+		cfgDir = filepath.Join(*flagSource, cfgDir)
+	}
+	cfgDir = absPath(cfgDir)
+
+	buf, err := ioutil.ReadFile(filepath.Join(cfgDir, cfgName))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -75,10 +138,39 @@ func parseConfig() {
 		log.Fatal(err)
 	}
 	tmp := AllSections[:0]
+	Config.BasePath = "/"
+	var source, destination string
+	var ignore []string
 	// Check mandatory fields and set defaults.
 	for si, s := range AllSections {
 		if s.Dir == "" {
 			Config.SiteURL = s.URL
+			Config.BasePath = cleanBasePath(s.BasePath)
+			source = s.Source
+			destination = s.Destination
+			Config.GitIgnore = s.GitIgnore
+			Config.MinifyHTML = s.MinifyHTML
+			Config.PostProcess = s.PostProcess
+			compilePostProcessors(s.PostProcess)
+			checkSearchConfig(s.Search)
+			Config.Search = s.Search
+			ignore = s.Ignore
+			if s.Style != "" {
+				siteSection.Style = s.Style
+			}
+			siteSection.IncludeCSS = s.IncludeCSS
+			siteSection.IncludeJS = s.IncludeJS
+			siteSection.IndexSort = s.IndexSort
+			if siteSection.IndexSort == "" {
+				siteSection.IndexSort = "id"
+			}
+			Config.GlobalTags = s.GlobalTags
+			setTagAliases(s.TagAliases)
+			siteSection.TagMeta = s.TagMeta
+			siteSection.Title = s.Title
+			siteSection.Params = cleanYAML(s.Params).(map[string]interface{})
+			checkTaxonomies(s.Taxonomies)
+			Config.Taxonomies = s.Taxonomies
 			continue
 		}
 		if s.Rules == nil {
@@ -97,9 +189,17 @@ func parseConfig() {
 			s.IndexSort = "id"
 		}
 
+		s.ignore = newIgnoreList(append([]string{"/" + tagMetaDir + "/*.yaml"}, s.Ignore...), s.Dir)
+		compilePostProcessors(s.PostProcess)
+		checkSearchConfig(s.Search)
+
 		for ri, r := range s.Rules {
 			r.s = s
 
+			if r.generated() {
+				checkGenerateRule(r, ri, si)
+				continue
+			}
 			if r.In == "" {
 				log.Fatalf("no `In` filter specified for rule n. %d in section n. %d (%q)", ri+1, si+1, s.Dir)
 			}
@@ -126,4 +226,6 @@ func parseConfig() {
 	}
 
 	AllSections = tmp
+	siteIgnore = newIgnoreList(append(append([]string{}, defaultIgnore...), ignore...), "")
+	setupRoots(source, destination)
 }
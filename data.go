@@ -0,0 +1,175 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	toml "github.com/pelletier/go-toml/v2"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// The files inside _formica/data/ are loaded at startup and made available
+// to templates as .Site.Data. A file is found under its name, extension
+// excluded, and subdirectories become nested maps: data/authors/xojoc.yaml
+// is .Site.Data.authors.xojoc.
+//
+// YAML, JSON and TOML files hold whatever they contain, CSV files are lists
+// of records keyed by the names found in the first row.
+const dataDir = "data"
+
+var (
+	siteData = make(map[string]interface{})
+	// modification time of the newest data file (or directory, for files
+	// removed), pages older than this must be rendered again.
+	dataModTime time.Time
+)
+
+// cleanYAML turns the map[interface{}]interface{} given by yaml.v2 into
+// map[string]interface{}, like the one given by the other formats.
+func cleanYAML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{})
+		for k, e := range v {
+			m[fmt.Sprint(k)] = cleanYAML(e)
+		}
+		return m
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = cleanYAML(e)
+		}
+	case []interface{}:
+		for n, e := range v {
+			v[n] = cleanYAML(e)
+		}
+	}
+	return v
+}
+
+func readCSV(buf []byte) ([]map[string]string, error) {
+	rows, err := csv.NewReader(bytes.NewReader(buf)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	records := []map[string]string{}
+	if len(rows) == 0 {
+		return records, nil
+	}
+	for _, row := range rows[1:] {
+		r := make(map[string]string)
+		for n, name := range rows[0] {
+			r[name] = row[n]
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// readDataFile returns the content of the data file p, or false if p is not
+// a data file.
+func readDataFile(p string) (interface{}, bool) {
+	ext := strings.ToLower(filepath.Ext(p))
+	switch ext {
+	case ".yaml", ".yml", ".json", ".toml", ".csv":
+	default:
+		return nil, false
+	}
+	buf, err := ioutil.ReadFile(p)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var v interface{}
+	switch ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(buf, &v)
+		v = cleanYAML(v)
+	case ".json":
+		err = json.Unmarshal(buf, &v)
+	case ".toml":
+		err = toml.Unmarshal(buf, &v)
+	case ".csv":
+		v, err = readCSV(buf)
+	}
+	if err != nil {
+		log.Fatalf("%s: %v", p, err)
+	}
+	return v, true
+}
+
+// loadData reads the data directory.
+func loadData() {
+	root := filepath.Join(cfgDir, dataDir)
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return
+	}
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.ModTime().After(dataModTime) {
+				dataModTime = info.ModTime()
+			}
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		v, ok := readDataFile(p)
+		if !ok {
+			return nil
+		}
+		if info.ModTime().After(dataModTime) {
+			dataModTime = info.ModTime()
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		m := siteData
+		dirs := strings.Split(filepath.ToSlash(filepath.Dir(rel)), "/")
+		for _, d := range dirs {
+			if d == "." {
+				continue
+			}
+			sub, ok := m[d].(map[string]interface{})
+			if !ok {
+				sub = make(map[string]interface{})
+				m[d] = sub
+			}
+			m = sub
+		}
+		name := strings.TrimSuffix(filepath.Base(p), filepath.Ext(p))
+		if _, ok := m[name]; ok {
+			log.Fatalf("%s: data %q already defined", p, name)
+		}
+		m[name] = v
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,199 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Rules with Data or Command, instead of In, generate an item for every
+// record of a data file (relative to _formica/data/) or of the JSON array
+// printed by a command:
+//
+//	rules:
+//	  - data: projects.yaml
+//	    out: "{slug}.html"
+//	    exec: pandoc
+//
+// Record fields are read like the header of an item (title, slug, id,
+// date, tags...) and are all available in User too. The `body' field is
+// given to Exec, or used as it is if there's no Exec. Records without an
+// id are numbered from 1. CSV fields are converted as described in
+// csvRecord.
+const recordBody = "body"
+
+func (r *rule) generated() bool {
+	return r.Data != "" || r.Command != ""
+}
+
+func checkGenerateRule(r *rule, ri, si int) {
+	if r.In != "" {
+		log.Fatalf("rule n. %d in section n. %d (%q) has both `In` and `Data` or `Command`", ri+1, si+1, r.s.Dir)
+	}
+	if r.Data != "" && r.Command != "" {
+		log.Fatalf("rule n. %d in section n. %d (%q) has both `Data` and `Command`", ri+1, si+1, r.s.Dir)
+	}
+	if r.Out == "" {
+		log.Fatalf("no `Out` filter specified for rule n. %d in section n. %d (%q)", ri+1, si+1, r.s.Dir)
+	}
+	r.NoHeader = true
+	r.outtpl = pathToTpl(r.Out, r.s.Dir+"/")
+}
+
+// readRecords returns the records of r and the name they come from.
+func readRecords(r *rule) ([]map[string]interface{}, string) {
+	var v interface{}
+	var src string
+	if r.Data != "" {
+		src = filepath.Join(filepath.Base(cfgDir), dataDir, r.Data)
+		var ok bool
+		v, ok = readDataFile(filepath.Join(cfgDir, dataDir, r.Data))
+		if !ok {
+			log.Fatalf("%s: unknown data format", src)
+		}
+	} else {
+		src = "`" + r.Command + "`"
+		var buf bytes.Buffer
+		execShellIO(r.Command, nil, &buf, nil)
+		err := json.Unmarshal(buf.Bytes(), &v)
+		if err != nil {
+			log.Fatalf("%s: %v", src, err)
+		}
+	}
+
+	var records []map[string]interface{}
+	switch v := v.(type) {
+	case []map[string]string: // CSV
+		for n, rec := range v {
+			records = append(records, csvRecord(rec, src, n))
+		}
+	case []interface{}:
+		for n, e := range v {
+			m, ok := e.(map[string]interface{})
+			if !ok {
+				log.Fatalf("%s: record n. %d is not a map", src, n+1)
+			}
+			records = append(records, m)
+		}
+	default:
+		log.Fatalf("%s: not a list of records", src)
+	}
+	return records, src
+}
+
+// csvRecord converts the fields of a CSV record, which are all strings, to
+// the types an item header would have: id, year, month and day are numbers,
+// draft and noindex booleans, and tags and taxonomy terms comma separated
+// lists. Empty numbers and booleans are left out.
+func csvRecord(rec map[string]string, src string, n int) map[string]interface{} {
+	m := make(map[string]interface{})
+	for k, e := range rec {
+		switch {
+		case k == "id" || k == "year" || k == "month" || k == "day":
+			if strings.TrimSpace(e) == "" {
+				continue
+			}
+			d, err := strconv.Atoi(strings.TrimSpace(e))
+			if err != nil {
+				log.Fatalf("%s: record n. %d: %s: %q is not a number", src, n+1, k, e)
+			}
+			m[k] = d
+		case k == "draft" || k == "noindex":
+			if strings.TrimSpace(e) == "" {
+				continue
+			}
+			b, err := strconv.ParseBool(strings.TrimSpace(e))
+			if err != nil {
+				log.Fatalf("%s: record n. %d: %s: %q is not a boolean", src, n+1, k, e)
+			}
+			m[k] = b
+		case k == "tags" || isTaxonomy(k):
+			l := []interface{}{}
+			for _, t := range strings.Split(e, ",") {
+				if t = strings.TrimSpace(t); t != "" {
+					l = append(l, t)
+				}
+			}
+			m[k] = l
+		default:
+			m[k] = e
+		}
+	}
+	return m
+}
+
+func isTaxonomy(name string) bool {
+	for _, t := range Config.Taxonomies {
+		if t.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func recordToItem(rec map[string]interface{}, n int, src string, r *rule) *item {
+	i := &item{}
+	i.Id = n + 1
+	i.inpath = fmt.Sprintf("%s[%d]", src, n+1)
+	i.r = r
+	i.User = make(map[string]interface{})
+	i.terms = make(map[string][]string)
+
+	h := make(map[string]interface{})
+	for k, v := range rec {
+		if k == recordBody {
+			i.content = []byte(fmt.Sprint(v))
+			continue
+		}
+		h[k] = v
+	}
+	b, err := yaml.Marshal(h)
+	if err != nil {
+		log.Fatalf("%s: %v", i.inpath, err)
+	}
+	err = yaml.Unmarshal(b, i)
+	if err != nil {
+		log.Fatalf("%s: %v", i.inpath, err)
+	}
+	termsFromHeader(i, b)
+	for k, v := range h {
+		i.User[k] = v
+	}
+	return completeItem(i)
+}
+
+// generateItems adds the items generated by every rule with Data or Command.
+func generateItems() {
+	for _, s := range AllSections {
+		for _, r := range s.Rules {
+			if !r.generated() {
+				continue
+			}
+			records, src := readRecords(r)
+			for n, rec := range records {
+				s.items = append(s.items, recordToItem(rec, n, src, r))
+			}
+		}
+	}
+}
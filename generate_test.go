@@ -0,0 +1,49 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestCSVRecord(t *testing.T) {
+	rec := map[string]string{
+		"id":      " 7",
+		"title":   "Formica",
+		"tags":    "go, web,,C++ ",
+		"draft":   "true",
+		"noindex": "",
+		"year":    "",
+	}
+	b, err := yaml.Marshal(csvRecord(rec, "data/projects.csv", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var i item
+	err = yaml.Unmarshal(b, &i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.Id != 7 || i.Title != "Formica" || !i.Draft || i.NoIndex || i.Year != 0 {
+		t.Errorf("csvRecord(%q) gave %+v", rec, i)
+	}
+	if want := []string{"go", "web", "C++"}; !reflect.DeepEqual(i.Tags, want) {
+		t.Errorf("csvRecord(%q) gave tags %q, want %q", rec, i.Tags, want)
+	}
+}
@@ -3,7 +3,11 @@ module xojoc.pw/formica
 go 1.21.3
 
 require (
+	github.com/alecthomas/chroma/v2 v2.14.0
 	github.com/gorilla/feeds v1.1.2
+	github.com/pelletier/go-toml/v2 v2.2.2
 	gopkg.in/yaml.v2 v2.4.0
 	xojoc.pw/must v0.0.0-20200116205440-3a9b4d24dd53
 )
+
+require github.com/dlclark/regexp2 v1.11.0 // indirect
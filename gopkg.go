@@ -0,0 +1,241 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	gobuild "go/build"
+	"go/doc"
+	"go/format"
+	"go/parser"
+	"go/token"
+	htpl "html/template"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Items with GoPath set document a Go package. Its sources are read from
+// GoDir (relative to the source directory) or, if GoDir is missing, from the
+// directory `go list' finds for GoPath in the module of the source
+// directory. Nothing is fetched from the network: a package that can't be
+// found is reported and the page is rendered without it.
+//
+// The package is available to templates as .Go, with its README given to
+// the rule's Exec, its doc comment and its exported API. It's read only
+// when a template uses it.
+type goPackage struct {
+	ImportPath string
+	Name       string
+	Synopsis   string
+	Doc        htpl.HTML
+	README     htpl.HTML
+	Consts     []*goDecl
+	Vars       []*goDecl
+	Funcs      []*goDecl
+	Types      []*goType
+}
+
+type goDecl struct {
+	Name string
+	Decl string // Go source of the declaration, bodies excluded
+	Doc  htpl.HTML
+}
+
+type goType struct {
+	goDecl
+	Consts  []*goDecl
+	Vars    []*goDecl
+	Funcs   []*goDecl // constructors
+	Methods []*goDecl
+}
+
+var readmeNames = []string{"README.md", "README.markdown", "README.txt", "README"}
+
+// goDirs caches the directories found by goDir, by import path.
+var goDirs = make(map[string]string)
+
+// goDir returns the directory holding the sources of the package of i, or
+// "" if there's none.
+func goDir(i *item) string {
+	if i.GoDir != "" {
+		return srcPath(i.GoDir)
+	}
+	if i.GoPath == "" {
+		return ""
+	}
+	if d, ok := goDirs[i.GoPath]; ok {
+		return d
+	}
+	var out, stderr bytes.Buffer
+	cmd := exec.Command("go", "list", "-f", "{{.Dir}}", i.GoPath)
+	cmd.Dir = srcDir
+	cmd.Env = append(os.Environ(), "GOPROXY=off")
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	d := ""
+	if err := cmd.Run(); err != nil {
+		msg := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		log.Printf("%s: can't find package %q, set `godir': %v: %s", i.inpath, i.GoPath, err, msg[len(msg)-1])
+	} else {
+		d = strings.TrimSpace(out.String())
+	}
+	goDirs[i.GoPath] = d
+	return d
+}
+
+func readGoPackage(i *item) *goPackage {
+	dir := goDir(i)
+	if dir == "" {
+		return nil
+	}
+	fset := token.NewFileSet()
+	// the files the go tool would build, tests excluded
+	built := func(fi fs.FileInfo) bool {
+		ok, err := gobuild.Default.MatchFile(dir, fi.Name())
+		return err == nil && ok && !strings.HasSuffix(fi.Name(), "_test.go")
+	}
+	pkgs, err := parser.ParseDir(fset, dir, built, parser.ParseComments)
+	if err != nil {
+		log.Fatalf("%s: %v", i.inpath, err)
+	}
+	// the first package by name, main only if it's the only one
+	var names []string
+	for name := range pkgs {
+		if !strings.HasSuffix(name, "_test") {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(a, b int) bool {
+		if (names[a] == "main") != (names[b] == "main") {
+			return names[b] == "main"
+		}
+		return names[a] < names[b]
+	})
+	var files []*ast.File
+	if len(names) > 0 {
+		var fnames []string
+		for fname := range pkgs[names[0]].Files {
+			fnames = append(fnames, fname)
+		}
+		sort.Strings(fnames)
+		for _, fname := range fnames {
+			files = append(files, pkgs[names[0]].Files[fname])
+		}
+	}
+	if files == nil {
+		log.Fatalf("%s: no Go files in %q", i.inpath, dir)
+	}
+	importPath := i.GoPath
+	if importPath == "" {
+		importPath = files[0].Name.Name
+	}
+	dp, err := doc.NewFromFiles(fset, files, importPath)
+	if err != nil {
+		log.Fatalf("%s: %v", i.inpath, err)
+	}
+
+	pr := dp.Printer()
+	pr.DocLinkBaseURL = "https://pkg.go.dev"
+	html := func(text string) htpl.HTML {
+		return htpl.HTML(pr.HTML(dp.Parser().Parse(text)))
+	}
+	decl := func(n ast.Node) string {
+		var b bytes.Buffer
+		err := format.Node(&b, fset, n)
+		if err != nil {
+			log.Fatalf("%s: %v", i.inpath, err)
+		}
+		return b.String()
+	}
+	values := func(vs []*doc.Value) []*goDecl {
+		var ds []*goDecl
+		for _, v := range vs {
+			ds = append(ds, &goDecl{Name: strings.Join(v.Names, ", "), Decl: decl(v.Decl), Doc: html(v.Doc)})
+		}
+		return ds
+	}
+	funcs := func(fs []*doc.Func) []*goDecl {
+		var ds []*goDecl
+		for _, f := range fs {
+			ds = append(ds, &goDecl{Name: f.Name, Decl: decl(f.Decl), Doc: html(f.Doc)})
+		}
+		return ds
+	}
+
+	pkg := &goPackage{
+		ImportPath: importPath,
+		Name:       dp.Name,
+		Synopsis:   dp.Synopsis(dp.Doc),
+		Doc:        html(dp.Doc),
+		README:     readme(i, dir),
+		Consts:     values(dp.Consts),
+		Vars:       values(dp.Vars),
+		Funcs:      funcs(dp.Funcs),
+	}
+	for _, t := range dp.Types {
+		pkg.Types = append(pkg.Types, &goType{
+			goDecl:  goDecl{Name: t.Name, Decl: decl(t.Decl), Doc: html(t.Doc)},
+			Consts:  values(t.Consts),
+			Vars:    values(t.Vars),
+			Funcs:   funcs(t.Funcs),
+			Methods: funcs(t.Methods),
+		})
+	}
+	return pkg
+}
+
+// readme returns the README found in dir, rendered by the rule's Exec.
+func readme(i *item, dir string) htpl.HTML {
+	for _, n := range readmeNames {
+		f, err := os.Open(filepath.Join(dir, n))
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+		if i.r.Exec == "" {
+			var b bytes.Buffer
+			b.ReadFrom(f)
+			return htpl.HTML(b.String())
+		}
+		var b bytes.Buffer
+		execShellIO(i.r.Exec, f, &b, nil)
+		return htpl.HTML(b.String())
+	}
+	return ""
+}
+
+// goPackageOf returns the package documented by i, nil if there's none.
+func goPackageOf(i *item) *goPackage {
+	if i.GoPath == "" && i.GoDir == "" {
+		return nil
+	}
+	if !i.goPkgRead {
+		i.goPkg = readGoPackage(i)
+		i.goPkgRead = true
+	}
+	return i.goPkg
+}
+
+// Go returns the package documented by the item, nil if there's none.
+func (i *itemContext) Go() *goPackage {
+	return goPackageOf(i.item)
+}
@@ -16,18 +16,23 @@
 package main
 
 import (
+	"html"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 	"time"
+	"unicode"
 )
 
 func execShellIO(cmdstr string, in io.Reader, out io.Writer, stderr io.Writer) {
 	cmd := exec.Command("sh", "-c", cmdstr)
+	cmd.Dir = srcDir
 	cmd.Stdin = in
 	cmd.Stdout = out
 	if stderr != nil {
@@ -44,15 +49,102 @@ func execShell(cmdstr string) {
 	execShellIO(cmdstr, nil, nil, nil)
 }
 
+var (
+	tagRe        = regexp.MustCompile(`(?s)<(/?)([a-zA-Z0-9!]*)[^>]*>`)
+	rawElemRe    = regexp.MustCompile(`(?is)<script[^>]*>.*?</script>|<style[^>]*>.*?</style>|<!--.*?-->`)
+	whitespaceRe = regexp.MustCompile(`\s+`)
+)
+
+// stripTags returns the text of the HTML fragment s. Block elements
+// separate words, scripts, styles and comments are dropped.
+func stripTags(s string) string {
+	s = rawElemRe.ReplaceAllString(s, " ")
+	s = tagRe.ReplaceAllStringFunc(s, func(t string) string {
+		if htmlBlockTags[strings.ToLower(tagRe.FindStringSubmatch(t)[2])] {
+			return " "
+		}
+		return ""
+	})
+	return strings.TrimSpace(whitespaceRe.ReplaceAllString(html.UnescapeString(s), " "))
+}
+
+// slugify turns s into something usable inside URLs and as an HTML id.
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(r)
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// srcPath returns the path of p, relative to the source directory.
+func srcPath(p string) string {
+	return filepath.Join(srcDir, p)
+}
+
 func copyFile(i string, o string) {
+	recordOutput(o, i)
 	if !newer(i, o) {
 		return
 	}
+	in, err := os.Open(i)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		log.Fatal(err)
+	}
+	copyTo(o, in, fi)
+}
+
+// copyTo writes r to o, giving it the mode and modification time of fi.
+func copyTo(o string, r io.Reader, fi os.FileInfo) {
 	err := os.MkdirAll(filepath.Dir(o), 0755)
 	if err != nil {
 		log.Fatal(err)
 	}
-	execShell("cp " + i + " " + o)
+	out, err := os.Create(o)
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = io.Copy(out, r)
+	if err == nil {
+		err = out.Close()
+	} else {
+		out.Close()
+	}
+	if err == nil {
+		err = os.Chmod(o, fi.Mode().Perm())
+	}
+	if err == nil {
+		err = os.Chtimes(o, fi.ModTime(), fi.ModTime())
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func writeFile(p string, b []byte) {
+	recordOutput(p, "")
+	err := os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = ioutil.WriteFile(p, b, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
 }
 
 func newer(a string, b string) bool {
@@ -67,6 +159,14 @@ func newer(a string, b string) bool {
 	return sta.ModTime().After(stb.ModTime())
 }
 
+func newerTime(t time.Time, b string) bool {
+	stb, err := os.Stat(b)
+	if err != nil {
+		return true
+	}
+	return t.After(stb.ModTime())
+}
+
 func newerGlob(glob string, b string) bool {
 	fs, err := filepath.Glob(glob)
 	if err != nil {
@@ -0,0 +1,200 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// Fenced code blocks of sections with Highlight set are highlighted:
+//
+//	```go linenos hl=2,4-5
+//	...
+//	```
+//
+// linenos shows line numbers (LineNumbers does the same for every block)
+// and hl highlights the lines given. Blocks are taken out of the body before
+// it's given to Exec and put back, highlighted, afterwards.
+
+const (
+	highlightCSS      = "highlight.css"
+	highlightThemeDef = "github"
+)
+
+type codeBlock struct {
+	lang        string
+	code        string
+	lineNumbers bool
+	hl          [][2]int
+}
+
+func codeBlockMarker(n int) string {
+	return fmt.Sprintf("<!--formica-code-block-%d-->", n)
+}
+
+// parseLineRanges parses "2,4-5"
+func parseLineRanges(s string) ([][2]int, error) {
+	var rs [][2]int
+	for _, r := range strings.Split(s, ",") {
+		from, to := r, r
+		if n := strings.IndexByte(r, '-'); n >= 0 {
+			from, to = r[:n], r[n+1:]
+		}
+		f, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, err
+		}
+		t, err := strconv.Atoi(to)
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, [2]int{f, t})
+	}
+	return rs, nil
+}
+
+func fence(line string) string {
+	t := strings.TrimLeft(line, " ")
+	if len(line)-len(t) > 3 {
+		return ""
+	}
+	for _, f := range []string{"```", "~~~"} {
+		if strings.HasPrefix(t, f) {
+			n := len(t) - len(strings.TrimLeft(t, f[:1]))
+			return t[:n]
+		}
+	}
+	return ""
+}
+
+// extractCodeBlocks replaces the fenced code blocks of body with markers.
+func extractCodeBlocks(i *item, body []byte) ([]byte, []*codeBlock) {
+	var blocks []*codeBlock
+	var out bytes.Buffer
+	lines := strings.SplitAfter(string(body), "\n")
+	for l := 0; l < len(lines); l++ {
+		open := fence(lines[l])
+		if open == "" {
+			out.WriteString(lines[l])
+			continue
+		}
+		info := strings.Fields(strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(lines[l]), open[:1])))
+		cb := &codeBlock{lineNumbers: i.r.s.LineNumbers}
+		for n, f := range info {
+			switch {
+			case n == 0 && !strings.Contains(f, "="):
+				cb.lang = f
+			case f == "linenos":
+				cb.lineNumbers = true
+			case strings.HasPrefix(f, "hl="):
+				var err error
+				cb.hl, err = parseLineRanges(strings.TrimPrefix(f, "hl="))
+				if err != nil {
+					log.Fatalf("%s: %q: %v", i.inpath, lines[l], err)
+				}
+			}
+		}
+		var code strings.Builder
+		for l++; l < len(lines); l++ {
+			if c := fence(lines[l]); c != "" && c[0] == open[0] && len(c) >= len(open) && strings.TrimSpace(lines[l]) == c {
+				break
+			}
+			code.WriteString(lines[l])
+		}
+		cb.code = code.String()
+		out.WriteString("\n" + codeBlockMarker(len(blocks)) + "\n\n")
+		blocks = append(blocks, cb)
+	}
+	return out.Bytes(), blocks
+}
+
+func highlight(cb *codeBlock) string {
+	lexer := lexers.Get(cb.lang)
+	if lexer == nil {
+		lexer = lexers.Analyse(cb.code)
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+	f := chtml.New(chtml.WithClasses(true), chtml.WithLineNumbers(cb.lineNumbers), chtml.HighlightLines(cb.hl))
+	it, err := lexer.Tokenise(nil, cb.code)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var b bytes.Buffer
+	err = f.Format(&b, styles.Fallback, it)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return b.String()
+}
+
+// restoreCodeBlocks puts back, highlighted, the blocks taken out by
+// extractCodeBlocks. An Exec which drops or escapes the markers would lose
+// the blocks, so that's an error.
+func restoreCodeBlocks(i *item, body []byte, blocks []*codeBlock) []byte {
+	for n, cb := range blocks {
+		re := regexp.MustCompile(`(?:<p>\s*)?` + regexp.QuoteMeta(codeBlockMarker(n)) + `(?:\s*</p>)?`)
+		h := []byte(highlight(cb))
+		found := false
+		body = re.ReplaceAllFunc(body, func([]byte) []byte {
+			found = true
+			return h
+		})
+		if !found {
+			log.Fatalf("%s: code block n. %d was lost by `%s', it must keep HTML comments", i.inpath, n+1, i.r.Exec)
+		}
+	}
+	return body
+}
+
+// genStyleCSS runs the `gen-style-css' command, it writes the stylesheet of
+// a highlighting theme into a style directory.
+func genStyleCSS(args []string) {
+	fs := flag.NewFlagSet("gen-style-css", flag.ExitOnError)
+	style := fs.String("style", styleDef, "style directory to write "+highlightCSS+" into")
+	theme := fs.String("theme", highlightThemeDef, "highlighting theme, one of: "+strings.Join(styles.Names(), ", "))
+	fs.Parse(args)
+
+	s := styles.Get(*theme)
+	if s == styles.Fallback && *theme != s.Name {
+		log.Fatalf("unknown theme %q", *theme)
+	}
+	var b bytes.Buffer
+	err := chtml.New(chtml.WithClasses(true)).WriteCSS(&b, s)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p := stylePath(*style) + highlightCSS
+	if _, err := os.Stat(stylePath(*style)); err != nil {
+		log.Fatal(err)
+	}
+	writeFile(p, b.Bytes())
+	fmt.Println(p)
+}
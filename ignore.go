@@ -0,0 +1,227 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const formicaIgnore = ".formicaignore"
+
+// ignorePattern is a single gitignore-style pattern. Patterns only apply to
+// paths below base, which is relative to the source directory.
+type ignorePattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+	base    string
+}
+
+// ignoreList follows gitignore semantics: the last matching pattern wins.
+type ignoreList []*ignorePattern
+
+var siteIgnore ignoreList
+
+// defaultIgnore comes before the site's `ignore' patterns, which can undo
+// them, e.g. with `!node_modules/'.
+var defaultIgnore = []string{".git/", "node_modules/", "*.swp", "*~", ".#*"}
+
+func globToRe(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**/") {
+				b.WriteString(`(?:.*/)?`)
+				i += 2
+			} else if strings.HasPrefix(glob[i:], "**") {
+				b.WriteString(`.*`)
+				i++
+			} else {
+				b.WriteString(`[^/]*`)
+			}
+		case '?':
+			b.WriteString(`[^/]`)
+		case '[':
+			j := strings.IndexByte(glob[i+1:], ']')
+			if j < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += j + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+func newIgnorePattern(line, base string) *ignorePattern {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+	p := &ignorePattern{base: base}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	restr := ""
+	if strings.Contains(line, "/") {
+		// anchored to base
+		restr = "^" + globToRe(strings.TrimPrefix(line, "/")) + "$"
+	} else {
+		restr = "(?:^|/)" + globToRe(line) + "$"
+	}
+	re, err := regexp.Compile(restr)
+	if err != nil {
+		log.Fatalf("ignore pattern %q: %v", line, err)
+	}
+	p.re = re
+	return p
+}
+
+func newIgnoreList(lines []string, base string) ignoreList {
+	var l ignoreList
+	for _, line := range lines {
+		if p := newIgnorePattern(line, base); p != nil {
+			l = append(l, p)
+		}
+	}
+	return l
+}
+
+// readIgnoreFile reads the patterns found in the file named name inside the
+// directory dir (relative to the source directory). A missing file is not an error.
+func readIgnoreFile(dir, name string) ignoreList {
+	f, err := os.Open(srcPath(filepath.Join(dir, name)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		log.Fatal(err)
+	}
+	defer f.Close()
+	var lines []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	if err := sc.Err(); err != nil {
+		log.Fatal(err)
+	}
+	return newIgnoreList(lines, dir)
+}
+
+// relTo returns p relative to base, or false if p is not below base.
+func relTo(p, base string) (string, bool) {
+	if base == "" || base == "." {
+		return p, true
+	}
+	if !strings.HasPrefix(p, base+"/") {
+		return "", false
+	}
+	return p[len(base)+1:], true
+}
+
+// ignored reports whether the path p (relative to the source directory) is
+// ignored, either directly or because one of its parent directories is.
+func (l ignoreList) ignored(p string, isDir bool) bool {
+	p = filepath.ToSlash(p)
+	for i := 0; i < len(p); i++ {
+		if p[i] == '/' && l.match(p[:i], true) {
+			return true
+		}
+	}
+	return l.match(p, isDir)
+}
+
+func (l ignoreList) match(p string, isDir bool) bool {
+	ign := false
+	for _, pat := range l {
+		if pat.dirOnly && !isDir {
+			continue
+		}
+		rel, ok := relTo(p, pat.base)
+		if !ok {
+			continue
+		}
+		if pat.re.MatchString(rel) {
+			ign = !pat.negate
+		}
+	}
+	return ign
+}
+
+// loadIgnoreFiles adds to the site ignore list the patterns found in dir.
+func loadIgnoreFiles(dir string) {
+	siteIgnore = append(siteIgnore, readIgnoreFile(dir, formicaIgnore)...)
+	if Config.GitIgnore {
+		siteIgnore = append(siteIgnore, readIgnoreFile(dir, ".gitignore")...)
+	}
+}
+
+// inDir reports whether p is inside the section's directory.
+func (s *section) inDir(p string) bool {
+	_, ok := relTo(p, s.Dir)
+	return ok
+}
+
+// ignoredDir reports whether the whole directory p can be skipped: either the
+// site ignores it or every section containing it does.
+func ignoredDir(p string) bool {
+	if filepath.Join(srcDir, p) == filepath.Clean(buildDir) {
+		return true
+	}
+	if siteIgnore.ignored(p, true) {
+		return true
+	}
+	covered := false
+	for _, s := range AllSections {
+		if !s.inDir(p) {
+			if _, ok := relTo(s.Dir, p); ok {
+				// a section lives below p
+				return false
+			}
+			continue
+		}
+		if !s.ignore.ignored(p, true) {
+			return false
+		}
+		covered = true
+	}
+	return covered
+}
@@ -0,0 +1,86 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import "testing"
+
+func TestIgnored(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		base     string
+		path     string
+		isDir    bool
+		ignored  bool
+	}{
+		{[]string{"*.tmp"}, "", "a.tmp", false, true},
+		{[]string{"*.tmp"}, "", "dir/sub/a.tmp", false, true},
+		{[]string{"*.tmp"}, "", "a.tmpx", false, false},
+		{[]string{"drafts/"}, "", "drafts", true, true},
+		{[]string{"drafts/"}, "", "drafts", false, false},
+		{[]string{"drafts/"}, "", "blog/drafts/a.md", false, true},
+		{[]string{"/drafts"}, "", "drafts/a.md", false, true},
+		{[]string{"/drafts"}, "", "blog/drafts/a.md", false, false},
+		{[]string{"blog/*.md"}, "", "blog/a.md", false, true},
+		{[]string{"blog/*.md"}, "", "blog/sub/a.md", false, false},
+		{[]string{"**/x.md"}, "", "a/b/x.md", false, true},
+		{[]string{"**/x.md"}, "", "x.md", false, true},
+		{[]string{"a/**"}, "", "a/b/c", false, true},
+		{[]string{"file?.md"}, "", "file1.md", false, true},
+		{[]string{"file?.md"}, "", "file10.md", false, false},
+		{[]string{"[ab].md"}, "", "b.md", false, true},
+		{[]string{"[!ab].md"}, "", "b.md", false, false},
+		{[]string{"*.md", "!keep.md"}, "", "keep.md", false, false},
+		{[]string{"*.md", "!keep.md"}, "", "other.md", false, true},
+		{[]string{"!keep.md", "*.md"}, "", "keep.md", false, true},
+		{[]string{"# comment", ""}, "", "# comment", false, false},
+		{[]string{`\#lit`}, "", "#lit", false, true},
+		{[]string{"*.tmp"}, "blog", "blog/a.tmp", false, true},
+		{[]string{"*.tmp"}, "blog", "notes/a.tmp", false, false},
+		{[]string{"/a.md"}, "blog", "blog/a.md", false, true},
+		{[]string{"/a.md"}, "blog", "blog/x/a.md", false, false},
+	}
+	for _, tt := range tests {
+		l := newIgnoreList(tt.patterns, tt.base)
+		if got := l.ignored(tt.path, tt.isDir); got != tt.ignored {
+			t.Errorf("%q (base %q).ignored(%q, %v) = %v, want %v", tt.patterns, tt.base, tt.path, tt.isDir, got, tt.ignored)
+		}
+	}
+}
+
+func TestDefaultIgnore(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		path     string
+		isDir    bool
+		ignored  bool
+	}{
+		{nil, ".git", true, true},
+		{nil, "blog/.git/config", false, true},
+		{nil, "node_modules/x/index.js", false, true},
+		{nil, "blog/a.md.swp", false, true},
+		{nil, "blog/a.md~", false, true},
+		{nil, "blog/.#a.md", false, true},
+		{nil, "blog/a.md", false, false},
+		{[]string{"!node_modules/"}, "node_modules/x/index.js", false, false},
+		{[]string{"!*~"}, "blog/a.md~", false, false},
+	}
+	for _, tt := range tests {
+		l := newIgnoreList(append(append([]string{}, defaultIgnore...), tt.patterns...), "")
+		if got := l.ignored(tt.path, tt.isDir); got != tt.ignored {
+			t.Errorf("%q.ignored(%q, %v) = %v, want %v", tt.patterns, tt.path, tt.isDir, got, tt.ignored)
+		}
+	}
+}
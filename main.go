@@ -17,6 +17,7 @@ package main // import "xojoc.pw/formica"
 
 import (
 	"bufio"
+	"flag"
 	"io"
 	"log"
 	"os"
@@ -35,9 +36,12 @@ type item struct {
 	Month           int
 	Day             int
 	Tags            []string
-	GoPath          string
-	GoCode          string
-	GoDocumentation string
+	GoPath          string // import path of the documented package, see gopkg.go
+	GoDir           string // directory of the package sources
+	GoCode          string // URL of the package sources
+	GoDocumentation string // URL of the package documentation
+	Draft           bool
+	NoIndex         bool                   // keep out of the search index
 	User            map[string]interface{} // user variables
 
 	inpath  string
@@ -47,6 +51,17 @@ type item struct {
 	buf *bufio.Reader
 
 	r *rule // FIXME: refactor collect.go and remove this field
+
+	backlinks     []*item // items referring to this one
+	body          []byte  // rendered body, see GetBody
+	rendered      bool
+	update        bool // see needsUpdate
+	updateChecked bool
+	terms         map[string][]string // taxonomy name -> terms
+	content       []byte              // body of generated items, see generate.go
+	goPkg         *goPackage
+	goPkgRead     bool
+	resources     []*resource // of page bundles, see pagebundle.go
 }
 
 type rule struct {
@@ -58,38 +73,104 @@ type rule struct {
 	copy         bool
 	NoHeader     bool
 	Dependencies []string //FIXME: should be a list
+	Data         string   // generate items from this data file
+	Command      string   // generate items from the JSON printed by this command
+	Bundle       bool     // match page bundles
 
 	s *section
 }
 
 type section struct {
-	URL        string
-	Dir        string
-	Rules      []*rule
-	Title      string
-	Excerpt    string
-	Style      string
-	IncludeCSS []string
-	IncludeJS  []string
-	IndexSort  string
-	Feed       bool
-
-	items []*item
+	URL          string
+	BasePath     string
+	Source       string
+	Destination  string
+	GitIgnore    bool
+	Dir          string
+	Rules        []*rule
+	Title        string
+	Excerpt      string
+	Style        string
+	IncludeCSS   []string
+	IncludeJS    []string
+	IndexSort    string
+	Feed         bool
+	Ignore       []string
+	MinifyHTML   bool
+	PostProcess  map[string][]*postProcessor
+	RelatedCount int
+	Highlight    bool // highlight fenced code blocks
+	LineNumbers  bool // show line numbers of highlighted code
+	TOCDepth     int  // heading levels shown by TOC
+	SummaryWords int  // length of automatic summaries
+	Search       *searchConfig
+	Archive      bool              // render date archives
+	Taxonomies   []*taxonomy       // site only
+	GlobalTags   bool              // site only, render tag pages spanning all sections
+	TagAliases   map[string]string // site only
+	TagMeta      map[string]*tagMeta
+	Params       map[string]interface{} // site only
+
+	items  []*item
+	ignore ignoreList
+	tags   map[string][]*item
 }
 
 var AllSections []*section
 
 var Config struct {
-	SiteURL string
+	SiteURL     string
+	BasePath    string // URL path the site is served under, always begins and ends with `/'
+	GitIgnore   bool   // also honor .gitignore files
+	MinifyHTML  bool   // minify the HTML of every section
+	PostProcess map[string][]*postProcessor
+	Search      *searchConfig
+	Taxonomies  []*taxonomy
+	GlobalTags  bool
 }
 
-const buildDir = "_build/"
+var (
+	srcDir   = "."
+	buildDir = "_build/" // always ends with `/'
+)
+
+var (
+	flagSource      = flag.String("source", "", "directory containing the site (default: current directory)")
+	flagConfig      = flag.String("config", "", "configuration directory or file (default: <source>/"+cfgDir+")")
+	flagDestination = flag.String("destination", "", "output directory (default: <source>/"+buildDir+")")
+	flagDev         = flag.Bool("dev", false, "development build: don't minify and write source maps")
+)
 
 func main() {
 	log.SetPrefix(path.Base(os.Args[0]) + ": ")
 	log.SetFlags(log.Lshortfile)
+	flag.Parse()
+
+	switch flag.Arg(0) {
+	case "":
+		build()
+	case "check":
+		build()
+		check(flag.Args()[1:])
+	case "gen-style-css":
+		parseConfig()
+		genStyleCSS(flag.Args()[1:])
+	default:
+		log.Fatalf("unknown command %q", flag.Arg(0))
+	}
+}
+
+func build() {
 	parseConfig()
+	loadData()
+	startOutputWorkers()
 	collectItems()
+	normalizeTags()
+	loadTagMeta()
+	linkItems()
+	copyStatic()
+	bundleStyles()
 	renderAll()
 	copyAssets()
+	waitOutputs()
 }
@@ -0,0 +1,377 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"bytes"
+	"strings"
+)
+
+// The minifiers below are conservative: they only drop comments and
+// whitespace which can't change the meaning of the program.
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// copyQuoted copies the string literal starting at src[i] into b and returns
+// the index following it.
+func copyQuoted(b *bytes.Buffer, src []byte, i int) int {
+	q := src[i]
+	b.WriteByte(q)
+	for i++; i < len(src); i++ {
+		b.WriteByte(src[i])
+		if src[i] == '\\' && i+1 < len(src) {
+			i++
+			b.WriteByte(src[i])
+		} else if src[i] == q {
+			return i + 1
+		}
+	}
+	return i
+}
+
+func minifyCSS(src []byte) []byte {
+	var b bytes.Buffer
+	// no space is needed next to these
+	const punct = "{};,>"
+	space := false
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end < 0 {
+				i = len(src)
+			} else {
+				i += end + 4
+			}
+			continue
+		case isSpace(c):
+			space = true
+			i++
+			continue
+		}
+		last := byte(0)
+		if b.Len() > 0 {
+			last = b.Bytes()[b.Len()-1]
+		}
+		if space && last != 0 && !strings.ContainsRune(punct, rune(last)) && !strings.ContainsRune(punct, rune(c)) {
+			b.WriteByte(' ')
+		}
+		space = false
+		if c == '}' && last == ';' {
+			b.Truncate(b.Len() - 1)
+		}
+		if c == '"' || c == '\'' {
+			i = copyQuoted(&b, src, i)
+			continue
+		}
+		b.WriteByte(c)
+		i++
+	}
+	return b.Bytes()
+}
+
+// isRegexpStart reports whether a slash following the significant byte last
+// starts a regular expression literal rather than a division.
+func isRegexpStart(last byte, word string) bool {
+	switch word {
+	case "return", "typeof", "instanceof", "in", "of", "new", "delete", "void", "throw", "case", "do", "else", "yield", "await":
+		return true
+	}
+	return last == 0 || strings.IndexByte("(,=:[!&|?{};+-*%<>~^", last) >= 0
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// minifyJS removes comments, indentation and blank lines. Newlines are kept
+// so that automatic semicolon insertion keeps working.
+func minifyJS(src []byte) []byte {
+	var b bytes.Buffer
+	var last byte // last significant byte written
+	word := ""    // last identifier written
+	space, newline := false, false
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			continue
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end < 0 {
+				end = len(src) - i - 2
+			}
+			if bytes.IndexByte(src[i:i+end+2], '\n') >= 0 {
+				newline = true
+			} else {
+				space = true
+			}
+			i += end + 4
+			continue
+		case c == '\n':
+			newline = true
+			i++
+			continue
+		case isSpace(c):
+			space = true
+			i++
+			continue
+		}
+
+		if last != 0 {
+			if newline {
+				b.WriteByte('\n')
+			} else if space && isIdent(last) && isIdent(c) ||
+				space && (c == '+' || c == '-') && last == c {
+				b.WriteByte(' ')
+			}
+		}
+		space, newline = false, false
+
+		switch {
+		case c == '"' || c == '\'' || c == '`':
+			i = copyQuoted(&b, src, i)
+			last, word = c, ""
+		case c == '/' && isRegexpStart(last, word):
+			b.WriteByte(c)
+			inClass := false
+			for i++; i < len(src); i++ {
+				b.WriteByte(src[i])
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+					b.WriteByte(src[i])
+				} else if src[i] == '[' {
+					inClass = true
+				} else if src[i] == ']' {
+					inClass = false
+				} else if src[i] == '/' && !inClass || src[i] == '\n' {
+					break
+				}
+			}
+			i++
+			last, word = '/', ""
+		case isIdent(c):
+			j := i
+			for j < len(src) && isIdent(src[j]) {
+				j++
+			}
+			b.Write(src[i:j])
+			word = string(src[i:j])
+			last = src[j-1]
+			i = j
+		default:
+			b.WriteByte(c)
+			last, word = c, ""
+			i++
+		}
+	}
+	if b.Len() > 0 {
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// Whitespace next to these elements is never rendered.
+var htmlBlockTags = map[string]bool{
+	"!doctype": true, "html": true, "head": true, "body": true, "title": true,
+	"meta": true, "link": true, "base": true, "script": true, "style": true,
+	"noscript": true, "div": true, "p": true, "ul": true, "ol": true, "li": true,
+	"dl": true, "dt": true, "dd": true, "table": true, "caption": true,
+	"thead": true, "tbody": true, "tfoot": true, "tr": true, "td": true, "th": true,
+	"header": true, "footer": true, "nav": true, "main": true, "section": true,
+	"article": true, "aside": true, "h1": true, "h2": true, "h3": true, "h4": true,
+	"h5": true, "h6": true, "hr": true, "br": true, "form": true, "fieldset": true,
+	"figure": true, "figcaption": true, "blockquote": true, "pre": true,
+	"address": true, "details": true, "summary": true, "option": true,
+}
+
+// End tags which can always be omitted in valid documents.
+var htmlOptionalEndTags = map[string]bool{
+	"html": true, "head": true, "body": true, "li": true, "dt": true, "dd": true,
+	"tr": true, "td": true, "th": true, "thead": true, "tbody": true, "tfoot": true,
+	"option": true,
+}
+
+// The content of these elements is copied verbatim (or minified as CSS/JS).
+var htmlRawTags = map[string]bool{
+	"pre": true, "textarea": true, "script": true, "style": true,
+}
+
+// indexFold returns the index of the first instance of the lower case ASCII
+// string s in b, ignoring ASCII case, or -1. Unlike bytes.ToLower it never
+// changes the length of b, so the index is valid in b itself.
+func indexFold(b []byte, s string) int {
+	for i := 0; i+len(s) <= len(b); i++ {
+		match := true
+		for j := 0; j < len(s); j++ {
+			c := b[i+j]
+			if c >= 'A' && c <= 'Z' {
+				c += 'a' - 'A'
+			}
+			if c != s[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+// htmlTagEnd returns the index following the tag starting at src[i].
+func htmlTagEnd(src []byte, i int) int {
+	var q byte
+	for i++; i < len(src); i++ {
+		switch c := src[i]; {
+		case q != 0:
+			if c == q {
+				q = 0
+			}
+		case c == '"' || c == '\'':
+			q = c
+		case c == '>':
+			return i + 1
+		}
+	}
+	return i
+}
+
+// htmlTagName returns the lower case name of tag and whether it is an end tag.
+func htmlTagName(tag []byte) (string, bool) {
+	tag = tag[1:]
+	end := false
+	if len(tag) > 0 && tag[0] == '/' {
+		end = true
+		tag = tag[1:]
+	}
+	j := 0
+	for j < len(tag) && !isSpace(tag[j]) && tag[j] != '>' && tag[j] != '/' {
+		j++
+	}
+	return strings.ToLower(string(tag[:j])), end
+}
+
+// collapseTag squeezes the spaces between the attributes of tag.
+func collapseTag(tag []byte) []byte {
+	var b bytes.Buffer
+	var q byte
+	space := false
+	for _, c := range tag {
+		if q == 0 && isSpace(c) {
+			space = true
+			continue
+		}
+		if space && c != '>' && !(c == '/' && q == 0) {
+			b.WriteByte(' ')
+		}
+		space = false
+		if q != 0 && c == q {
+			q = 0
+		} else if q == 0 && (c == '"' || c == '\'') {
+			q = c
+		}
+		b.WriteByte(c)
+	}
+	return b.Bytes()
+}
+
+func isJSScript(tag []byte) bool {
+	t := strings.ToLower(string(tag))
+	i := strings.Index(t, "type=")
+	if i < 0 {
+		return true
+	}
+	t = strings.Trim(t[i+len("type="):], `"' >/`)
+	return strings.HasPrefix(t, "text/javascript") || strings.HasPrefix(t, "module") || strings.HasPrefix(t, "application/javascript")
+}
+
+// minifyHTML collapses whitespace, drops comments and optional end tags and
+// minifies inline CSS and JS. The content of <pre> and <textarea> is untouched.
+func minifyHTML(src []byte) []byte {
+	var b bytes.Buffer
+	space := false
+	block := true // last thing written was a block element
+	for i := 0; i < len(src); {
+		c := src[i]
+		if bytes.HasPrefix(src[i:], []byte("<!--")) {
+			end := bytes.Index(src[i+4:], []byte("-->"))
+			if end < 0 {
+				end = len(src) - i - 4
+			} else {
+				end += 3
+			}
+			com := src[i : i+4+end]
+			i += 4 + end
+			// keep conditional comments
+			if bytes.HasPrefix(com, []byte("<!--[if")) || bytes.HasSuffix(com, []byte("<![endif]-->")) {
+				b.Write(com)
+			}
+			continue
+		}
+		if c == '<' && i+1 < len(src) && (src[i+1] == '/' || src[i+1] == '!' || src[i+1] >= 'a' && src[i+1] <= 'z' || src[i+1] >= 'A' && src[i+1] <= 'Z') {
+			j := htmlTagEnd(src, i)
+			tag := src[i:j]
+			name, end := htmlTagName(tag)
+			i = j
+			if space && !block && !htmlBlockTags[name] {
+				b.WriteByte(' ')
+			}
+			space = false
+			block = htmlBlockTags[name]
+			if end && htmlOptionalEndTags[name] {
+				continue
+			}
+			b.Write(collapseTag(tag))
+			if end || !htmlRawTags[name] {
+				continue
+			}
+			k := indexFold(src[i:], "</"+name)
+			if k < 0 {
+				k = len(src) - i
+			}
+			content := src[i : i+k]
+			switch {
+			case name == "script" && isJSScript(tag):
+				content = bytes.TrimSpace(minifyJS(content))
+			case name == "style":
+				content = minifyCSS(content)
+			}
+			b.Write(content)
+			i += k
+			continue
+		}
+		if isSpace(c) {
+			space = true
+			i++
+			continue
+		}
+		if space && !block {
+			b.WriteByte(' ')
+		}
+		space, block = false, false
+		b.WriteByte(c)
+		i++
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,88 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import "testing"
+
+func TestMinifyHTML(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"<p>a   b</p>\n\n<p>c</p>", "<p>a b</p><p>c</p>"},
+		{"<div>\n  <span>a</span>\n  <span>b</span>\n</div>", "<div><span>a</span> <span>b</span></div>"},
+		{"<p>a<!-- comment -->b</p>", "<p>ab</p>"},
+		{"<!--[if IE]>x<![endif]-->", "<!--[if IE]>x<![endif]-->"},
+		{`<a  href="x"   title="a  b" >l</a>`, `<a href="x" title="a  b">l</a>`},
+		{"<ul>\n<li>a</li>\n<li>b</li>\n</ul>", "<ul><li>a<li>b</ul>"},
+		{"<pre>  a\n    b</pre>", "<pre>  a\n    b</pre>"},
+		{"<PRE>  a\n    b</PRE>", "<PRE>  a\n    b</PRE>"},
+		{"<textarea>  x  </textarea>", "<textarea>  x  </textarea>"},
+		{"<p>İİİİ</p><pre>  a\n    b</pre>", "<p>İİİİ</p><pre>  a\n    b</pre>"},
+		{"<p>İİİİ</p><pre>  a\n    b</PRE>", "<p>İİİİ</p><pre>  a\n    b</PRE>"},
+		{"<style>\nbody {\n  color: red;\n}\n</style>", "<style>body{color: red}</style>"},
+		{"<script>\n  var a = 1; // c\n</script>", "<script>var a=1;</script>"},
+		{`<script type="text/template">  <b> </script>`, `<script type="text/template">  <b> </script>`},
+		{"<pre>unterminated  x", "<pre>unterminated  x"},
+	}
+	for _, tt := range tests {
+		if got := string(minifyHTML([]byte(tt.in))); got != tt.out {
+			t.Errorf("minifyHTML(%q) = %q, want %q", tt.in, got, tt.out)
+		}
+	}
+}
+
+func TestMinifyCSS(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"body {\n  color: red;\n}\n", "body{color: red}"},
+		{"/* c */a , b > c { x: 1 ; y: 2; }", "a,b>c{x: 1;y: 2}"},
+		{"a { content: \"  /* x */  \"; }", "a{content: \"  /* x */  \"}"},
+		{"a { content: '\\'  }'; }", "a{content: '\\'  }'}"},
+		{"@media (max-width: 10px) {\n  a { b: c }\n}", "@media (max-width: 10px){a{b: c}}"},
+		{"a { margin: 0 auto }", "a{margin: 0 auto}"},
+		{"a{}/* unterminated", "a{}"},
+	}
+	for _, tt := range tests {
+		if got := string(minifyCSS([]byte(tt.in))); got != tt.out {
+			t.Errorf("minifyCSS(%q) = %q, want %q", tt.in, got, tt.out)
+		}
+	}
+}
+
+func TestMinifyJS(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"var a = 1;  // comment\n\n\nvar b = 2;", "var a=1;\nvar b=2;\n"},
+		{"a = b /* c */ + c", "a=b+c\n"},
+		{"a = b /* c\n */ + c", "a=b\n+c\n"},
+		{"return x\ny()", "return x\ny()\n"},
+		{"a = b + +c; d = e - -f", "a=b+ +c;d=e- -f\n"},
+		{`s = "a  // b" + 'c /* d */'`, `s="a  // b"+'c /* d */'` + "\n"},
+		{"t = `a\n  b`", "t=`a\n  b`\n"},
+		{"r = /a  b\\/[/]/g.test(x)", "r=/a  b\\/[/]/g.test(x)\n"},
+		{"x = a / b / c", "x=a/b/c\n"},
+		{"if (x) return /re  gexp/", "if(x)return/re  gexp/\n"},
+		{"typeof x", "typeof x\n"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := string(minifyJS([]byte(tt.in))); got != tt.out {
+			t.Errorf("minifyJS(%q) = %q, want %q", tt.in, got, tt.out)
+		}
+	}
+}
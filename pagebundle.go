@@ -0,0 +1,150 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Rules with Bundle set match page bundles: a directory holding the item,
+// e.g. post/index.md with `in: "{slug}/index.md"', and its resources, every
+// other file below the directory. Resources are copied, keeping their path
+// relative to the bundle directory, into the directory of the item: the
+// directory of its output if that's an index.html, so the item can link them
+// as they are, else its output without the extension (post.html gets post/).
+// The files of a bundle never match other rules.
+type resource struct {
+	Name      string // path relative to the bundle directory
+	Type      string // MIME type, e.g. image/png
+	Kind      string // first part of Type, e.g. image
+	Size      int64
+	Permalink string
+}
+
+// collectBundle collects dir if it's a page bundle and reports whether it was.
+func collectBundle(dir string) bool {
+	if dir == "." {
+		return false
+	}
+	entries, err := os.ReadDir(srcPath(dir))
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		f := filepath.Join(dir, e.Name())
+		if siteIgnore.ignored(f, false) {
+			continue
+		}
+		for _, s := range AllSections {
+			if s.ignore.ignored(f, false) {
+				continue
+			}
+			for _, r := range s.Rules {
+				if !r.Bundle || r.generated() || !r.inre.MatchString(f) {
+					continue
+				}
+				i := fileToItem(f, r)
+				i.resources = collectResources(i, dir, s)
+				s.items = append(s.items, i)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resourceOutputs maps the resources copied to the bundle they come from.
+var resourceOutputs = make(map[string]string)
+
+// resourceDir returns the directory the resources of i are copied into.
+func resourceDir(i *item) string {
+	if filepath.Base(i.outpath) == "index.html" {
+		return filepath.Dir(i.outpath)
+	}
+	return strings.TrimSuffix(i.outpath, filepath.Ext(i.outpath))
+}
+
+func collectResources(i *item, dir string, s *section) []*resource {
+	var rs []*resource
+	outdir := resourceDir(i)
+	err := filepath.Walk(srcPath(dir), func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		f, err := filepath.Rel(srcDir, p)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if f == dir {
+				// its ignore files were loaded by collectItem
+				return nil
+			}
+			if ignoredDir(f) || s.ignore.ignored(f, true) {
+				return filepath.SkipDir
+			}
+			loadIgnoreFiles(f)
+			return nil
+		}
+		if f == i.inpath || !info.Mode().IsRegular() || info.Name() == formicaIgnore || info.Name() == ".gitignore" || siteIgnore.ignored(f, false) || s.ignore.ignored(f, false) {
+			return nil
+		}
+		name, err := filepath.Rel(dir, f)
+		if err != nil {
+			return err
+		}
+		out := filepath.Join(outdir, name)
+		if b, ok := resourceOutputs[out]; ok {
+			log.Fatalf("%s: resource %s is also copied to %s by %s", i.inpath, name, out, b)
+		}
+		resourceOutputs[out] = i.inpath
+		copyFile(p, out)
+		typ := mime.TypeByExtension(filepath.Ext(name))
+		if typ == "" {
+			typ = "application/octet-stream"
+		}
+		typ, _, _ = mime.ParseMediaType(typ)
+		rs = append(rs, &resource{
+			Name:      filepath.ToSlash(name),
+			Type:      typ,
+			Kind:      strings.SplitN(typ, "/", 2)[0],
+			Size:      info.Size(),
+			Permalink: RelURL(filepath.ToSlash(strings.TrimPrefix(out, buildDir))),
+		})
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return rs
+}
+
+// Resource returns the resource of the item named name, or nil.
+func (i *itemContext) Resource(name string) *resource {
+	for _, r := range i.Resources {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"regexp"
+	"runtime"
+	"sync"
+)
+
+// Output formats.
+const (
+	formatHTML    = "html"
+	formatAtom    = "atom"
+	formatRSS     = "rss"
+	formatSitemap = "sitemap"
+)
+
+// A postProcessor transforms an output before it is written. It is either
+// one of the built-in processors (Name) or a shell command (Exec) reading the
+// output on stdin and writing the result on stdout.
+//
+//	postprocess:
+//	  html:
+//	    - name: anchors
+//	    - name: links
+//	      from: http://old.example.com/
+//	      to: /
+//	    - exec: tidy -q
+type postProcessor struct {
+	Name string
+	Exec string
+	From string // links: prefix to rewrite
+	To   string // links: replacement
+
+	fn func(p *postProcessor, format string, b []byte) []byte
+}
+
+var builtinProcessors = map[string]func(p *postProcessor, format string, b []byte) []byte{
+	"minify":  ppMinify,
+	"links":   ppLinks,
+	"anchors": ppAnchors,
+}
+
+func ppExec(p *postProcessor, format string, b []byte) []byte {
+	var out bytes.Buffer
+	execShellIO(p.Exec, bytes.NewReader(b), &out, nil)
+	return out.Bytes()
+}
+
+// ppMinify only knows about HTML, other formats are left as they are.
+func ppMinify(p *postProcessor, format string, b []byte) []byte {
+	if format != formatHTML || *flagDev {
+		return b
+	}
+	return minifyHTML(b)
+}
+
+var linkAttrRe = regexp.MustCompile(`(?i)(\s(?:href|src)\s*=\s*["']?)([^"'\s>]*)`)
+
+// ppLinks rewrites the href and src attributes beginning with From.
+func ppLinks(p *postProcessor, format string, b []byte) []byte {
+	return linkAttrRe.ReplaceAllFunc(b, func(m []byte) []byte {
+		sm := linkAttrRe.FindSubmatch(m)
+		if !bytes.HasPrefix(sm[2], []byte(p.From)) {
+			return m
+		}
+		return []byte(string(sm[1]) + p.To + string(sm[2][len(p.From):]))
+	})
+}
+
+var (
+	headingRe = regexp.MustCompile(`(?is)<h([1-6])([^>]*)>(.*?)</h[1-6]>`)
+	idAttrRe  = regexp.MustCompile(`(?i)\sid\s*=\s*["']?([^"'\s>]+)`)
+)
+
+// addHeadingIDs gives an id to every heading of b lacking one. The id is
+// built from the text of the heading, duplicates get a numeric suffix.
+// If anchor is true a link to the heading is appended to it.
+func addHeadingIDs(b []byte, anchor bool) []byte {
+	seen := make(map[string]int)
+	for _, m := range idAttrRe.FindAllSubmatch(b, -1) {
+		seen[string(m[1])]++
+	}
+	return headingRe.ReplaceAllFunc(b, func(m []byte) []byte {
+		sm := headingRe.FindSubmatch(m)
+		level, attrs, text := sm[1], sm[2], sm[3]
+		id := ""
+		if idm := idAttrRe.FindSubmatch(attrs); idm != nil {
+			id = string(idm[1])
+		} else {
+			base := slugify(stripTags(string(text)))
+			if base == "" {
+				base = "section"
+			}
+			id = base
+			for n := 1; seen[id] > 0; n++ {
+				id = fmt.Sprintf("%s-%d", base, n)
+			}
+			seen[id]++
+			attrs = append([]byte(` id="`+id+`"`), attrs...)
+		}
+		if anchor && !bytes.Contains(text, []byte(`class="anchor"`)) {
+			text = append(append([]byte{}, text...), []byte(` <a class="anchor" href="#`+id+`">#</a>`)...)
+		}
+		return []byte(fmt.Sprintf("<h%s%s>%s</h%s>", level, attrs, text, level))
+	})
+}
+
+func ppAnchors(p *postProcessor, format string, b []byte) []byte {
+	if format != formatHTML {
+		return b
+	}
+	return addHeadingIDs(b, true)
+}
+
+func compilePostProcessors(chains map[string][]*postProcessor) {
+	for format, chain := range chains {
+		switch format {
+		case formatHTML, formatAtom, formatRSS, formatSitemap:
+		default:
+			log.Fatalf("postprocess: unknown output format %q", format)
+		}
+		for _, p := range chain {
+			switch {
+			case p.Exec != "" && p.Name != "":
+				log.Fatalf("postprocess: both `name' (%q) and `exec' (%q) specified", p.Name, p.Exec)
+			case p.Exec != "":
+				p.fn = ppExec
+			case builtinProcessors[p.Name] != nil:
+				p.fn = builtinProcessors[p.Name]
+			default:
+				log.Fatalf("postprocess: unknown processor %q", p.Name)
+			}
+			if p.Name == "links" && p.From == "" {
+				log.Fatal("postprocess: `links' needs `from'")
+			}
+		}
+	}
+}
+
+// postProcessors returns the chain to apply to outputs of format. Sections
+// without their own chain use the site's one.
+func (s *section) postProcessors(format string) []*postProcessor {
+	chain, ok := s.PostProcess[format]
+	if !ok {
+		chain = Config.PostProcess[format]
+	}
+	if format == formatHTML && s.minifyHTML() {
+		chain = append(chain[:len(chain):len(chain)], &postProcessor{Name: "minify", fn: ppMinify})
+	}
+	return chain
+}
+
+type output struct {
+	path   string
+	format string
+	buf    []byte
+	chain  []*postProcessor
+}
+
+var (
+	outputQueue chan *output
+	outputWg    sync.WaitGroup
+)
+
+func outputWorker() {
+	for o := range outputQueue {
+		b := o.buf
+		for _, p := range o.chain {
+			b = p.fn(p, o.format, b)
+		}
+		writeFile(o.path, b)
+		outputWg.Done()
+	}
+}
+
+// startOutputWorkers starts the pool post processing and writing outputs.
+func startOutputWorkers() {
+	n := runtime.NumCPU()
+	outputQueue = make(chan *output, n)
+	for i := 0; i < n; i++ {
+		go outputWorker()
+	}
+}
+
+// queueOutput hands buf to the worker pool, chain is run on it before writing it to path.
+func queueOutput(path, format string, buf []byte, chain []*postProcessor) {
+	outputWg.Add(1)
+	outputQueue <- &output{path: path, format: format, buf: buf, chain: chain}
+}
+
+// waitOutputs waits until every queued output has been written.
+func waitOutputs() {
+	outputWg.Wait()
+}
@@ -0,0 +1,107 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+func sectionByDir(dir string) *section {
+	for _, s := range AllSections {
+		if s.Dir == dir {
+			return s
+		}
+	}
+	return nil
+}
+
+// findItem looks for the item of section s with the given slug. If none is
+// found and slug is a number the item with that id is looked for.
+func findItem(s *section, slug string) *item {
+	for _, i := range s.items {
+		if i.Slug == slug {
+			return i
+		}
+	}
+	if id, err := strconv.Atoi(slug); err == nil {
+		for _, i := range s.items {
+			if i.Id == id {
+				return i
+			}
+		}
+	}
+	return nil
+}
+
+func resolveRef(dir string, key interface{}) (*item, error) {
+	s := sectionByDir(dir)
+	if s == nil {
+		return nil, fmt.Errorf("no section %q", dir)
+	}
+	var i *item
+	switch k := key.(type) {
+	case int:
+		for _, it := range s.items {
+			if it.Id == k {
+				i = it
+				break
+			}
+		}
+	case string:
+		i = findItem(s, k)
+	default:
+		return nil, fmt.Errorf("ref key must be a slug or an id, not %T", key)
+	}
+	if i == nil {
+		return nil, fmt.Errorf("no item %v in section %q", key, dir)
+	}
+	return i, nil
+}
+
+// Ref returns the URL of the item of section dir identified by key, a slug
+// or an id. It's available to templates as `ref'.
+func Ref(dir string, key interface{}) (string, error) {
+	i, err := resolveRef(dir, key)
+	if err != nil {
+		return "", err
+	}
+	return itemURL(i), nil
+}
+
+// [[ref:slug]] refers to an item of the same section,
+// [[ref:section:slug]] to an item of another section.
+var refRe = regexp.MustCompile(`\[\[ref:([^\]:]+)(?::([^\]]+))?\]\]`)
+
+// expandRefs replaces the references found in the body of i with the URLs
+// of the items referred.
+func expandRefs(i *item, body []byte) []byte {
+	return refRe.ReplaceAllFunc(body, func(m []byte) []byte {
+		sm := refRe.FindSubmatch(m)
+		dir, slug := i.r.s.Dir, string(sm[1])
+		if len(sm[2]) > 0 {
+			dir, slug = slug, string(sm[2])
+		}
+		ref, err := resolveRef(dir, strings.TrimSpace(slug))
+		if err != nil {
+			log.Fatalf("%s: %s: %v", i.inpath, m, err)
+		}
+		return []byte(itemURL(ref))
+	})
+}
@@ -0,0 +1,199 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const relatedCountDef = 5
+
+// rawBody returns the body of i as found on disk, header excluded.
+func rawBody(i *item) []byte {
+	if i.r.generated() {
+		return i.content
+	}
+	b, err := ioutil.ReadFile(srcPath(i.inpath))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !i.r.NoHeader {
+		if n := bytes.Index(b, []byte("\n...\n")); n >= 0 {
+			b = b[n+len("\n...\n"):]
+		} else if bytes.HasPrefix(b, []byte("...\n")) {
+			b = b[len("...\n"):]
+		}
+	}
+	return b
+}
+
+// linkItems finds the references between items, so that each item knows
+// which ones refer to it.
+func linkItems() {
+	for _, s := range AllSections {
+		for _, i := range s.items {
+			seen := make(map[*item]bool)
+			for _, m := range refRe.FindAllSubmatch(rawBody(i), -1) {
+				dir, slug := s.Dir, string(m[1])
+				if len(m[2]) > 0 {
+					dir, slug = slug, string(m[2])
+				}
+				ref, err := resolveRef(dir, strings.TrimSpace(slug))
+				if err != nil {
+					log.Fatalf("%s: %s: %v", i.inpath, m[0], err)
+				}
+				if ref == i || seen[ref] {
+					continue
+				}
+				seen[ref] = true
+				ref.backlinks = append(ref.backlinks, i)
+			}
+		}
+	}
+}
+
+// contextFromOtherItem returns the context of i, which may belong to a
+// section other than the one of the page being rendered.
+func (ictx *itemContext) contextFromOtherItem(i *item) *itemContext {
+	if i.r.s == ictx.item.r.s {
+		return contextFromItem(i, ictx.Section)
+	}
+	return contextFromItemSection(i)
+}
+
+// contextFromItemSection returns the context of i within a shallow context
+// of its section, for pages not rendered by that section.
+func contextFromItemSection(i *item) *itemContext {
+	sctx := &sectionContext{Dir: i.r.s.Dir, Title: i.r.s.Title, Excerpt: i.r.s.Excerpt, section: i.r.s}
+	return contextFromItem(i, sctx)
+}
+
+// Backlinks returns the items referring to this one.
+func (ictx *itemContext) Backlinks() []*itemContext {
+	var is []*itemContext
+	for _, b := range ictx.item.backlinks {
+		is = append(is, ictx.contextFromOtherItem(b))
+	}
+	return is
+}
+
+// Related returns the items of the same section sharing most tags with this
+// one. Rare tags weigh more than common ones.
+func (ictx *itemContext) Related() []*itemContext {
+	var is []*itemContext
+	for _, o := range relatedItems(ictx.item) {
+		is = append(is, contextFromItem(o, ictx.Section))
+	}
+	return is
+}
+
+func relatedItems(i *item) []*item {
+	s := i.r.s
+	score := make(map[*item]float64)
+	for _, t := range i.Tags {
+		tagged := s.tags[t]
+		for _, o := range tagged {
+			if o != i {
+				score[o] += 1 / float64(len(tagged))
+			}
+		}
+	}
+	var related []*item
+	for o := range score {
+		related = append(related, o)
+	}
+	date := func(i *item) time.Time {
+		if i.Date == nil {
+			return time.Time{}
+		}
+		return i.Date.(time.Time)
+	}
+	sort.Slice(related, func(a, b int) bool {
+		ra, rb := related[a], related[b]
+		if score[ra] != score[rb] {
+			return score[ra] > score[rb]
+		}
+		if !date(ra).Equal(date(rb)) {
+			return date(ra).After(date(rb))
+		}
+		return ra.Id < rb.Id
+	})
+	n := s.RelatedCount
+	if n <= 0 {
+		n = relatedCountDef
+	}
+	if len(related) > n {
+		related = related[:n]
+	}
+	return related
+}
+
+// The pages of items show their backlinks and related items, so they are out
+// of date when those change. linksState keeps, inside the build directory,
+// the backlinks and related items of every item as of the last build.
+const linksState = ".links"
+
+var oldLinks, newLinks = make(map[string][]string), make(map[string][]string)
+
+func loadLinksState() {
+	b, err := ioutil.ReadFile(filepath.Join(buildDir, linksState))
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(b, &oldLinks)
+	if err != nil {
+		oldLinks = make(map[string][]string)
+	}
+}
+
+func saveLinksState() {
+	b, err := json.Marshal(newLinks)
+	if err != nil {
+		log.Fatal(err)
+	}
+	writeFile(filepath.Join(buildDir, linksState), b)
+}
+
+// linksChanged reports whether the backlinks or related items of i changed
+// since the last build, or were modified after the page of i.
+func linksChanged(i *item) bool {
+	var names []string
+	changed := false
+	for _, o := range append(append([]*item(nil), i.backlinks...), relatedItems(i)...) {
+		names = append(names, o.inpath)
+		if o.r.generated() || newer(srcPath(o.inpath), i.outpath) {
+			changed = true
+		}
+	}
+	newLinks[i.outpath] = names
+	old := oldLinks[i.outpath]
+	if len(old) != len(names) {
+		return true
+	}
+	for n := range old {
+		if old[n] != names[n] {
+			return true
+		}
+	}
+	return changed
+}
@@ -16,14 +16,10 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	htpl "html/template"
-	"io"
-	"io/ioutil"
 	"log"
-	"os"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -34,11 +30,38 @@ import (
 )
 
 const (
-	baseDir  = "/"
 	rssPath  = "/rss"
 	atomPath = "/atom"
 )
 
+// RelURL returns p relative to the site's base path.
+// Absolute URLs are returned untouched.
+func RelURL(p string) string {
+	if strings.Contains(p, "://") || strings.HasPrefix(p, "//") {
+		return p
+	}
+	return Config.BasePath + strings.TrimPrefix(p, "/")
+}
+
+// includeURL returns the URL of an IncludeCSS or IncludeJS entry: root
+// relative paths get the site's base path, anything else (relative paths,
+// absolute and data: URLs) is returned untouched.
+func includeURL(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") {
+		return p
+	}
+	return RelURL(p)
+}
+
+// AbsURL returns p as a full URL, site URL included.
+func AbsURL(p string) string {
+	p = RelURL(p)
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") {
+		return p
+	}
+	return strings.TrimSuffix(Config.SiteURL, "/") + p
+}
+
 type sectionContext struct {
 	Dir         string
 	Title       string
@@ -55,30 +78,30 @@ func contextFromSection(s *section) *sectionContext {
 	sctx.Dir = s.Dir
 	sctx.Title = s.Title
 	sctx.Excerpt = s.Excerpt
+	sctx.section = s
 	var is []*itemContext
 	for _, i := range s.items {
 		is = append(is, contextFromItem(i, sctx))
 	}
 	sctx.Items = is
-	sctx.section = s
 	return sctx
 }
 func (s *sectionContext) PageTitle() string {
 	return s.Title
 }
 func (s *sectionContext) AbsoluteURL() string {
-	p := filepath.Clean(baseDir + s.Dir)
-	if p == "/" {
-		return p
-	}
+	p := filepath.Clean(Config.BasePath + s.Dir)
 	if s.TagsContext {
-		return p + "/tags"
+		return strings.TrimSuffix(p, "/") + "/tags"
+	}
+	if p == filepath.Clean(Config.BasePath) {
+		return Config.BasePath
 	}
 	return p + "/"
 }
 func (s *sectionContext) FeedURL() string {
 	if s.section.Feed {
-		return baseDir + s.Dir + atomPath
+		return Config.BasePath + s.Dir + atomPath
 	}
 	return ""
 }
@@ -90,7 +113,7 @@ func (s *sectionContext) HomeURL() string {
 	return p
 }
 func (s *sectionContext) RootURL() string {
-	return baseDir
+	return Config.BasePath
 }
 func (s *sectionContext) HomeTitle() string {
 	return s.Title
@@ -99,28 +122,46 @@ func (s *sectionContext) GoPath() string {
 	return ""
 }
 func (s *sectionContext) Include() htpl.HTML {
-	fs, err := filepath.Glob(stylePath(s.section.Style) + "*.css")
-	if err != nil {
-		log.Fatal(err)
+	b := styleBundles[s.section.Style]
+	var css, js []string
+	if b != nil {
+		if b.cssURL != "" {
+			css = append(css, b.cssURL)
+		}
+		if b.jsURL != "" {
+			js = append(js, b.jsURL)
+		}
+	} else {
+		fs, err := filepath.Glob(stylePath(s.section.Style) + "*.css")
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, f := range fs {
+			css = append(css, RelURL("css/"+s.section.Style+"/"+filepath.Base(f)))
+		}
+		fs, err = filepath.Glob(stylePath(s.section.Style) + "*.js")
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, f := range fs {
+			js = append(js, RelURL("js/"+s.section.Style+"/"+filepath.Base(f)))
+		}
 	}
+
 	str := ""
-	for _, f := range fs {
-		str += fmt.Sprintf(`<link rel="stylesheet" href="%s" type="text/css">`, baseDir+"css/"+s.section.Style+"/"+filepath.Base(f))
+	for _, u := range css {
+		str += fmt.Sprintf(`<link rel="stylesheet" href="%s" type="text/css">`, u)
 	}
 	for _, i := range s.section.IncludeCSS {
-		str += fmt.Sprintf(`<link rel="stylesheet" href="%s" type="text/css">`, i)
+		str += fmt.Sprintf(`<link rel="stylesheet" href="%s" type="text/css">`, includeURL(i))
 	}
 
-	fs, err = filepath.Glob(stylePath(s.section.Style) + "*.js")
-	if err != nil {
-		log.Fatal(err)
-	}
-	for _, f := range fs {
-		str += fmt.Sprintf(`<script type="text/javascript" src="%s"></script>`, baseDir+"js/"+s.section.Style+"/"+filepath.Base(f))
+	for _, u := range js {
+		str += fmt.Sprintf(`<script type="text/javascript" src="%s"></script>`, u)
 	}
 
 	for _, i := range s.section.IncludeJS {
-		str += fmt.Sprintf(`<script type="text/javascript" src="%s"></script>`, i)
+		str += fmt.Sprintf(`<script type="text/javascript" src="%s"></script>`, includeURL(i))
 	}
 
 	if s.section.Feed {
@@ -132,38 +173,59 @@ func (s *sectionContext) Include() htpl.HTML {
 }
 
 type tagContext struct {
-	Tag     string
+	Tag     string // name, as written in the items
+	Slug    string
+	Section string // Dir of the section the tag page belongs to, empty for the global tag pages
 	Items   []*itemContext
+	Title   string // from the tag's metadata, see tagMeta
 	Excerpt string
+	Image   string
+
+	section *sectionContext
 }
 
-func contextFromTag(tag string, items []*itemContext) *tagContext {
-	return &tagContext{Tag: tag, Items: items}
+func contextFromTag(tag string, items []*itemContext, s *sectionContext) *tagContext {
+	t := &tagContext{Tag: tag, Slug: tagSlug(tag), Section: s.Dir, Items: items, section: s}
+	if m := s.section.tagMeta(t.Slug); m != nil {
+		t.Title = m.Title
+		t.Excerpt = m.Description
+		t.Image = m.Image
+	}
+	return t
 }
 func (t *tagContext) AbsoluteURL() string {
-	p := t.Items[0].Section.AbsoluteURL()
+	p := t.section.AbsoluteURL()
 	if strings.HasSuffix(p, "/tags") {
 		p = p + "/.."
 	}
-	return filepath.Clean(p + "/tag/" + t.Tag)
+	return filepath.Clean(p + "/tag/" + t.Slug)
 }
 func (t *tagContext) FeedURL() string {
-	return t.Items[0].FeedURL()
+	if t.section.section.Feed {
+		return t.AbsoluteURL() + atomPath
+	}
+	return ""
 }
 func (t *tagContext) PageTitle() string {
-	return t.Tag + " - " + t.Items[0].Section.Title
+	if t.Title != "" {
+		return t.Title
+	}
+	if t.Section == "" {
+		return t.Tag
+	}
+	return t.Tag + " - " + t.section.Title
 }
 func (t *tagContext) HomeURL() string {
-	return t.Items[0].HomeURL()
+	return t.section.HomeURL()
 }
 func (t *tagContext) RootURL() string {
-	return t.Items[0].RootURL()
+	return t.section.RootURL()
 }
 func (t *tagContext) HomeTitle() string {
-	return t.Items[0].HomeTitle()
+	return t.section.HomeTitle()
 }
 func (t *tagContext) Include() htpl.HTML {
-	return t.Items[0].Include()
+	return t.section.Include()
 }
 func (t *tagContext) GoPath() string {
 	return ""
@@ -182,6 +244,7 @@ type itemContext struct {
 	GoPath          string
 	GoCode          string
 	GoDocumentation string
+	Resources       []*resource
 
 	item *item
 }
@@ -199,7 +262,7 @@ func contextFromItem(i *item, s *sectionContext) *itemContext {
 	}
 	var tags []*tagContext
 	for _, tag := range i.Tags {
-		tags = append(tags, contextFromTag(tag, []*itemContext{ictx}))
+		tags = append(tags, contextFromTag(tag, []*itemContext{ictx}, s))
 	}
 	sort.Slice(tags, func(i, j int) bool { return strings.ToLower(tags[i].Tag) < strings.ToLower(tags[j].Tag) })
 	ictx.Tags = tags
@@ -210,12 +273,19 @@ func contextFromItem(i *item, s *sectionContext) *itemContext {
 
 	ictx.GoPath = i.GoPath
 	ictx.GoCode = i.GoCode
+	ictx.GoDocumentation = i.GoDocumentation
+	ictx.Resources = i.resources
 
 	return ictx
 }
 
+// itemURL returns the URL of the page rendered for i.
+func itemURL(i *item) string {
+	return RelURL(strings.TrimSuffix(strings.TrimPrefix(i.outpath, buildDir), ".html"))
+}
+
 func (i *itemContext) AbsoluteURL() string {
-	return baseDir + strings.TrimSuffix(strings.TrimPrefix(i.item.outpath, buildDir), ".html")
+	return itemURL(i.item)
 }
 func (i *itemContext) FeedURL() string {
 	return i.Section.FeedURL()
@@ -239,41 +309,45 @@ func (i *itemContext) GetBody() htpl.HTML {
 	return GetBody(i.item)
 }
 
-func outputTemplate(tplname, outpath, style string, cx interface{}) {
-	err := os.MkdirAll(filepath.Dir(outpath), 0755)
-	if err != nil {
-		log.Fatal(err)
-	}
-	f, err := os.Create(outpath)
-	if err != nil {
-		log.Fatal(err)
-	}
-	err = getStyleTpl(style).ExecuteTemplate(f, tplname, cx)
-	if err != nil {
-		log.Fatal(err)
-	}
-	err = f.Close()
+func (s *section) minifyHTML() bool {
+	return (s.MinifyHTML || Config.MinifyHTML) && !*flagDev
+}
+
+func outputTemplate(tplname, outpath string, s *section, cx interface{}) {
+	var buf bytes.Buffer
+	err := getStyleTpl(s.Style).ExecuteTemplate(&buf, tplname, cx)
 	if err != nil {
 		log.Fatal(err)
 	}
+	recordOutput(outpath, stylePath(s.Style)+tplname)
+	queueOutput(outpath, formatHTML, buf.Bytes(), s.postProcessors(formatHTML))
 }
 
 func outputFeeds(s *sectionContext) {
-	now := time.Now()
 	feed := &feeds.Feed{
-		Title:   s.HomeTitle() + " - Xojoc",
-		Link:    &feeds.Link{Href: s.AbsoluteURL()},
-		Created: now,
+		Title: s.HomeTitle() + " - Xojoc",
+		Link:  &feeds.Link{Href: s.AbsoluteURL()},
 	}
-	for _, i := range s.Items {
+	writeFeeds(feed, s.Items, filepath.Join(buildDir, s.Dir), s.section)
+}
+
+// writeFeeds fills feed with items and writes it, as Atom and RSS, inside dir.
+func writeFeeds(feed *feeds.Feed, items []*itemContext, dir string, s *section) {
+	feed.Created = time.Now()
+	for _, i := range items {
 		var date time.Time
 		if i.Date != nil {
 			date = *i.Date
 		}
+		desc := i.Excerpt
+		if desc == "" {
+			desc = i.Summary()
+		}
 		feed.Items = append(feed.Items, &feeds.Item{
-			Title:   i.Title,
-			Link:    &feeds.Link{Href: i.AbsoluteURL()},
-			Created: date,
+			Title:       i.Title,
+			Link:        &feeds.Link{Href: i.AbsoluteURL()},
+			Description: desc,
+			Created:     date,
 		})
 	}
 
@@ -287,17 +361,48 @@ func outputFeeds(s *sectionContext) {
 	rss, err := feed.ToRss()
 	must.OK(err)
 
-	must.OK(ioutil.WriteFile(buildDir+s.Dir+atomPath, []byte(atom), 0755))
-	must.OK(ioutil.WriteFile(buildDir+s.Dir+rssPath, []byte(rss), 0755))
+	queueOutput(filepath.Join(dir, atomPath), formatAtom, []byte(atom), s.postProcessors(formatAtom))
+	queueOutput(filepath.Join(dir, rssPath), formatRSS, []byte(rss), s.postProcessors(formatRSS))
 }
 
+// needsUpdate reports whether the page of i must be rendered again. The
+// answer is computed once per build: the page may be written meanwhile.
 func (i *item) needsUpdate() bool {
-	if newer(i.inpath, i.outpath) {
+	if !i.updateChecked {
+		i.update = i.checkUpdate()
+		i.updateChecked = true
+	}
+	return i.update
+}
+
+func (i *item) checkUpdate() bool {
+	if linksChanged(i) {
+		return true
+	}
+	if i.r.generated() {
+		return true
+	}
+	if newer(srcPath(i.inpath), i.outpath) {
 		return true
 	}
 	if newerGlob(stylePath(i.r.s.Style)+"*.html", i.outpath) {
 		return true
 	}
+	if newerGlob(filepath.Join(stylePath(i.r.s.Style), shortcodesDir, "*.html"), i.outpath) {
+		return true
+	}
+	if newerTime(assetsModTime, i.outpath) {
+		return true
+	}
+	if newerTime(dataModTime, i.outpath) {
+		return true
+	}
+	if newerTime(siteModTime, i.outpath) && usesSite(i.r.s.Style) {
+		return true
+	}
+	if d := goDir(i); d != "" && newerGlob(filepath.Join(d, "*"), i.outpath) {
+		return true
+	}
 	for _, d := range i.r.Dependencies {
 		tpl := pathToTpl(d, i.r.s.Dir+"/")
 		var b bytes.Buffer
@@ -305,7 +410,7 @@ func (i *item) needsUpdate() bool {
 		if err != nil {
 			log.Fatal(err)
 		}
-		if newerGlob(b.String(), i.outpath) {
+		if newerGlob(srcPath(b.String()), i.outpath) {
 			return true
 		}
 	}
@@ -313,24 +418,25 @@ func (i *item) needsUpdate() bool {
 }
 
 func outputSitemap(sitemap []string) {
-	f := must.Create(buildDir + "/sitemap.xml")
-	_, err := f.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+	var f bytes.Buffer
+	f.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
 <urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9" xmlns:xhtml="http://www.w3.org/1999/xhtml">` + "\n")
-	must.OK(err)
 
 	for _, l := range sitemap {
-		_, err := f.WriteString(`<url><loc>` + Config.SiteURL + l + `</loc></url>` + "\n")
-		must.OK(err)
+		f.WriteString(`<url><loc>` + Config.SiteURL + l + `</loc></url>` + "\n")
 	}
 
-	_, err = f.WriteString(`</urlset>` + "\n")
-	must.OK(err)
-	must.Close(f)
+	f.WriteString(`</urlset>` + "\n")
+	queueOutput(filepath.Join(buildDir, "sitemap.xml"), formatSitemap, f.Bytes(), Config.PostProcess[formatSitemap])
 }
 
 func renderAll() {
 	var sitemap []string
 
+	setupSite()
+	loadLinksState()
+	loadTextsState()
+
 	for _, s := range AllSections {
 		sctx := contextFromSection(s)
 		sitemap = append(sitemap, sctx.AbsoluteURL())
@@ -340,6 +446,7 @@ func renderAll() {
 				tags[t] = append(tags[t], i)
 			}
 		}
+		s.tags = tags
 		var tsctx []*tagContext
 		var tagnames []string
 		for k := range tags {
@@ -353,30 +460,27 @@ func renderAll() {
 			for _, item := range items {
 				is = append(is, contextFromItem(item, sctx))
 			}
-			tctx := contextFromTag(tagname, is)
-			outputTemplate("tag.html", buildDir+s.Dir+"/tag/"+tagname+".html", s.Style, tctx)
+			tctx := contextFromTag(tagname, is, sctx)
+			outputTemplate("tag.html", filepath.Join(buildDir, s.Dir, "tag", tctx.Slug+".html"), s, tctx)
+			if s.Feed {
+				outputTagFeeds(tctx)
+			}
 			tsctx = append(tsctx, tctx)
 
 			sitemap = append(sitemap, tctx.AbsoluteURL())
 		}
 		sctx.Tags = tsctx
 		sctx.TagsContext = true
-		outputTemplate("tags.html", buildDir+s.Dir+"/tags.html", s.Style, sctx)
+		outputTemplate("tags.html", filepath.Join(buildDir, s.Dir, "tags.html"), s, sctx)
 		sctx.TagsContext = false
 
 		hasIndex := false
 		seenOutpaths := make(map[string]*item)
 
 		for _, i := range s.items {
-			if i.GoPath != "" {
-				f := must.Open(os.Getenv("GOPATH") + "/src/" + i.GoPath + "/README.md")
-				i.buf = bufio.NewReader(io.MultiReader(f, i.buf))
-				if i.Title == "" {
-					i.Title = i.GoPath
-				}
-			}
-
-			if filepath.Base(i.outpath) == "index.html" {
+			// only the section's own index, not that of a page bundle
+			// like <section>/post/index.html
+			if i.outpath == filepath.Join(buildDir, s.Dir, "index.html") {
 				hasIndex = true
 			}
 
@@ -388,21 +492,33 @@ func renderAll() {
 
 			icx := contextFromItem(i, sctx)
 			if i.needsUpdate() {
-				outputTemplate("single.html", i.outpath, s.Style, icx)
+				outputTemplate("single.html", i.outpath, s, icx)
 			}
+			recordOutput(i.outpath, i.inpath)
 
 			sitemap = append(sitemap, icx.AbsoluteURL())
 		}
 
 		if !hasIndex {
 			SortItemsBy(s.items, strings.Split(s.IndexSort, ",")...)
-			outputTemplate("index.html", buildDir+s.Dir+"/index.html", s.Style, contextFromSection(s))
+			outputTemplate("index.html", filepath.Join(buildDir, s.Dir, "index.html"), s, contextFromSection(s))
 		}
 
 		if s.Feed {
 			outputFeeds(sctx)
 		}
+
+		if s.Archive {
+			sitemap = append(sitemap, outputArchives(sctx)...)
+		}
+
+		indexSection(sctx)
 	}
 
+	sitemap = append(sitemap, renderGlobalTags()...)
+	sitemap = append(sitemap, renderTaxonomies()...)
+	outputSearchIndex()
 	outputSitemap(sitemap)
+	saveLinksState()
+	saveTextsState()
 }
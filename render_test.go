@@ -0,0 +1,38 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import "testing"
+
+func TestIncludeURL(t *testing.T) {
+	defer func(b string) { Config.BasePath = b }(Config.BasePath)
+	Config.BasePath = "/project/"
+	tests := []struct {
+		in, out string
+	}{
+		{"/css/x.css", "/project/css/x.css"},
+		{"css/x.css", "css/x.css"},
+		{"../x.js", "../x.js"},
+		{"//cdn.example.com/x.js", "//cdn.example.com/x.js"},
+		{"https://example.com/x.css", "https://example.com/x.css"},
+		{"data:text/css,p{color:red}", "data:text/css,p{color:red}"},
+	}
+	for _, tt := range tests {
+		if got := includeURL(tt.in); got != tt.out {
+			t.Errorf("includeURL(%q) = %q, want %q", tt.in, got, tt.out)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	htpl "html/template"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// Sections with a `search' entry have their items indexed. Fields lists
+// what goes into the index (default: all of them) and BodyWords limits the
+// length of the body text (default: no limit). Items marked as `draft' or
+// `noindex' are left out.
+//
+// The index is written to /search.json, or, if the site's `search' entry
+// has `shard' set, to search.json inside every section.
+type searchConfig struct {
+	Fields    []string
+	BodyWords int
+	Shard     bool // site only
+}
+
+const searchIndexName = "search.json"
+
+var searchFields = []string{"title", "url", "tags", "excerpt", "body"}
+
+type searchEntry struct {
+	Section string   `json:"section"`
+	Title   string   `json:"title,omitempty"`
+	URL     string   `json:"url,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Excerpt string   `json:"excerpt,omitempty"`
+	Body    string   `json:"body,omitempty"`
+}
+
+var searchIndex []*searchEntry
+
+func checkSearchConfig(sc *searchConfig) {
+	if sc == nil {
+		return
+	}
+	if sc.Fields == nil {
+		sc.Fields = searchFields
+	}
+	for _, f := range sc.Fields {
+		found := false
+		for _, sf := range searchFields {
+			found = found || f == sf
+		}
+		if !found {
+			log.Fatalf("search: unknown field %q (known fields: %s)", f, strings.Join(searchFields, ", "))
+		}
+	}
+}
+
+func searchEntryFromItem(i *itemContext, sc *searchConfig) *searchEntry {
+	e := &searchEntry{Section: i.Section.Dir}
+	for _, f := range sc.Fields {
+		switch f {
+		case "title":
+			e.Title = i.Title
+		case "url":
+			e.URL = i.AbsoluteURL()
+		case "tags":
+			e.Tags = i.item.Tags
+		case "excerpt":
+			e.Excerpt = i.Excerpt
+			if e.Excerpt == "" {
+				e.Excerpt = i.Summary()
+			}
+		case "body":
+			words := strings.Fields(i.bodyText())
+			if sc.BodyWords > 0 && len(words) > sc.BodyWords {
+				words = words[:sc.BodyWords]
+			}
+			e.Body = strings.Join(words, " ")
+		}
+	}
+	return e
+}
+
+// indexSection adds the items of s to the search index. Items whose page is
+// up to date are indexed from the texts kept by the last build (textsState).
+func indexSection(s *sectionContext) {
+	sc := s.section.Search
+	if sc == nil {
+		return
+	}
+	var entries []*searchEntry
+	for _, i := range s.Items {
+		if i.item.Draft || i.item.NoIndex {
+			continue
+		}
+		entries = append(entries, searchEntryFromItem(i, sc))
+	}
+	if Config.Search != nil && Config.Search.Shard {
+		writeSearchIndex(filepath.Join(buildDir, s.Dir, searchIndexName), entries)
+		return
+	}
+	searchIndex = append(searchIndex, entries...)
+}
+
+func writeSearchIndex(p string, entries []*searchEntry) {
+	if entries == nil {
+		entries = []*searchEntry{}
+	}
+	b, err := json.Marshal(entries)
+	if err != nil {
+		log.Fatal(err)
+	}
+	queueOutput(p, "", b, nil)
+}
+
+// outputSearchIndex writes the site wide index.
+func outputSearchIndex() {
+	if Config.Search != nil && Config.Search.Shard {
+		return
+	}
+	for _, s := range AllSections {
+		if s.Search != nil {
+			writeSearchIndex(filepath.Join(buildDir, searchIndexName), searchIndex)
+			return
+		}
+	}
+}
+
+// searchIndexURL returns the URL of the index searched from section s.
+func searchIndexURL(s *section) string {
+	if Config.Search != nil && Config.Search.Shard {
+		return RelURL(s.Dir + "/" + searchIndexName)
+	}
+	return RelURL(searchIndexName)
+}
+
+const searchUI = `<div class="search"><input type="search" placeholder="Search" autocomplete="off"><ul class="search-results"></ul></div>
+<script>
+(function() {
+	var div = document.currentScript.previousElementSibling;
+	var input = div.querySelector("input"), results = div.querySelector("ul");
+	var index = null;
+	function show() {
+		var q = input.value.toLowerCase().split(/\s+/).filter(function(w) { return w; });
+		results.innerHTML = "";
+		if (!q.length) return;
+		index.filter(function(e) {
+			var t = [e.title, e.excerpt, e.body, (e.tags || []).join(" ")].join(" ").toLowerCase();
+			return q.every(function(w) { return t.indexOf(w) >= 0; });
+		}).slice(0, 20).forEach(function(e) {
+			var li = document.createElement("li"), a = document.createElement("a");
+			a.href = e.url;
+			a.textContent = e.title || e.url;
+			li.appendChild(a);
+			results.appendChild(li);
+		});
+	}
+	input.addEventListener("input", function() {
+		if (index) return show();
+		fetch(%q).then(function(r) { return r.json(); }).then(function(i) { index = i; show(); });
+	});
+})();
+</script>`
+
+func (s *sectionContext) SearchUI() htpl.HTML {
+	return htpl.HTML(fmt.Sprintf(searchUI, searchIndexURL(s.section)))
+}
+func (t *tagContext) SearchUI() htpl.HTML {
+	return t.Items[0].SearchUI()
+}
+func (i *itemContext) SearchUI() htpl.HTML {
+	return i.Section.SearchUI()
+}
@@ -0,0 +1,135 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"bytes"
+	htpl "html/template"
+	"log"
+	"path/filepath"
+	"regexp"
+)
+
+// Shortcodes are templates living in the shortcodes directory of a style,
+// a shortcode is named after its file (figure.html is `figure'). Inside an
+// item's body
+//
+//	{{< figure src="x.png" caption="A picture" >}}
+//	{{< note type="warning" >}}Some *inner* content{{< /note >}}
+//
+// are replaced, before the body is given to the rule's Exec, with the
+// result of executing the template with a shortcodeContext.
+const shortcodesDir = "shortcodes"
+
+type shortcodeContext struct {
+	Name   string
+	Params map[string]string
+	Inner  htpl.HTML
+	Item   *item
+}
+
+// Get returns the parameter named name or "" if it wasn't given.
+func (sc *shortcodeContext) Get(name string) string {
+	return sc.Params[name]
+}
+
+var shortcodeTpls = make(map[string]*htpl.Template)
+
+func getShortcodeTpl(style string) *htpl.Template {
+	if t, ok := shortcodeTpls[style]; ok {
+		return t
+	}
+	t := htpl.New(shortcodesDir).Funcs(styleFuncs(style))
+	glob := filepath.Join(stylePath(style), shortcodesDir, "*.html")
+	fs, err := filepath.Glob(glob)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(fs) > 0 {
+		t, err = t.ParseGlob(glob)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	shortcodeTpls[style] = t
+	return t
+}
+
+var (
+	shortcodeRe      = regexp.MustCompile(`\{\{<\s*(/?)([\w-]+)((?:\s+[\w-]+=(?:"[^"]*"|'[^']*'|[^\s"'>]+))*)\s*(/?)\s*>\}\}`)
+	shortcodeParamRe = regexp.MustCompile(`([\w-]+)=(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// closingShortcode returns the position of the tag closing the shortcode
+// name inside body, nested shortcodes with the same name taken into account.
+func closingShortcode(body []byte, name string) (start, end int, ok bool) {
+	depth := 0
+	for _, m := range shortcodeRe.FindAllSubmatchIndex(body, -1) {
+		if string(body[m[4]:m[5]]) != name {
+			continue
+		}
+		closing := m[3] > m[2]
+		selfClosing := m[9] > m[8]
+		switch {
+		case closing && depth == 0:
+			return m[0], m[1], true
+		case closing:
+			depth--
+		case !selfClosing:
+			depth++
+		}
+	}
+	return 0, 0, false
+}
+
+// expandShortcodes replaces the shortcodes found in body.
+func expandShortcodes(i *item, body []byte) []byte {
+	var out bytes.Buffer
+	for {
+		m := shortcodeRe.FindSubmatchIndex(body)
+		if m == nil {
+			out.Write(body)
+			return out.Bytes()
+		}
+		out.Write(body[:m[0]])
+		name := string(body[m[4]:m[5]])
+		if m[3] > m[2] {
+			log.Fatalf("%s: unexpected %s", i.inpath, body[m[0]:m[1]])
+		}
+		sc := &shortcodeContext{Name: name, Params: make(map[string]string), Item: i}
+		for _, p := range shortcodeParamRe.FindAllSubmatch(body[m[6]:m[7]], -1) {
+			sc.Params[string(p[1])] = string(p[2]) + string(p[3]) + string(p[4])
+		}
+		rest := body[m[1]:]
+		if m[9] == m[8] {
+			if start, end, ok := closingShortcode(rest, name); ok {
+				sc.Inner = htpl.HTML(expandShortcodes(i, rest[:start]))
+				rest = rest[end:]
+			}
+		}
+		t := getShortcodeTpl(i.r.s.Style).Lookup(name + ".html")
+		if t == nil {
+			log.Fatalf("%s: unknown shortcode %q (no %s)", i.inpath, name, filepath.Join(stylePath(i.r.s.Style), shortcodesDir, name+".html"))
+		}
+		var b bytes.Buffer
+		err := t.Execute(&b, sc)
+		if err != nil {
+			log.Fatalf("%s: %v", i.inpath, err)
+		}
+		out.Write(bytes.TrimRight(b.Bytes(), "\n"))
+		body = rest
+	}
+}
@@ -0,0 +1,227 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template/parse"
+	"time"
+)
+
+// siteContext is reachable from every template as .Site.
+type siteContext struct {
+	SiteURL   string
+	Title     string
+	Sections  []*sectionContext
+	Items     []*itemContext // of every section, latest first
+	Tags      []*tagContext  // of every section, their pages exist only with `globaltags'
+	Data      map[string]interface{}
+	Params    map[string]interface{} // the site's `params'
+	BuildTime time.Time
+}
+
+var site = &siteContext{Data: siteData, BuildTime: time.Now()}
+
+// setupSite fills site with the sections and their items.
+func setupSite() {
+	site.SiteURL = Config.SiteURL
+	site.Title = siteSection.Title
+	site.Params = siteSection.Params
+	for _, s := range AllSections {
+		SortItemsBy(s.items, strings.Split(s.IndexSort, ",")...)
+		sctx := contextFromSection(s)
+		site.Sections = append(site.Sections, sctx)
+		site.Items = append(site.Items, sctx.Items...)
+	}
+	sort.SliceStable(site.Items, func(i, j int) bool {
+		a, b := site.Items[i].Date, site.Items[j].Date
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return a.After(*b)
+	})
+	site.Tags = globalTags(contextFromSection(siteSection))
+	checkSiteState()
+}
+
+// The pages of items whose templates use .Site depend on every other item.
+// siteState keeps, inside the build directory, a digest of every item; when
+// it changes (items added, removed or modified) siteModTime is set and those
+// pages are rendered again.
+const siteState = ".site"
+
+var (
+	siteModTime   time.Time
+	styleUsesSite = make(map[string]bool)
+)
+
+func checkSiteState() {
+	var state bytes.Buffer
+	for _, s := range AllSections {
+		for _, i := range s.items {
+			var src string
+			if i.r.generated() {
+				src = string(i.content)
+			} else {
+				st, err := os.Stat(srcPath(i.inpath))
+				if err != nil {
+					log.Fatal(err)
+				}
+				src = st.ModTime().String()
+			}
+			h := hashBytes([]byte(fmt.Sprintf("%v %v %v %v %v %v %v %v %s", i.Id, i.Title, i.Excerpt, i.Slug, i.Date, i.Tags, i.Draft, i.User, src)))
+			fmt.Fprintf(&state, "%s %s %s\n", i.inpath, i.outpath, h)
+		}
+	}
+	p := filepath.Join(buildDir, siteState)
+	old, err := ioutil.ReadFile(p)
+	if err == nil && bytes.Equal(old, state.Bytes()) {
+		return
+	}
+	siteModTime = time.Now()
+	err = os.MkdirAll(buildDir, 0755)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = ioutil.WriteFile(p, state.Bytes(), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// usesSite reports whether the templates or shortcodes of style use .Site.
+func usesSite(style string) bool {
+	if u, ok := styleUsesSite[style]; ok {
+		return u
+	}
+	u := false
+	for _, t := range append(getStyleTpl(style).Templates(), getShortcodeTpl(style).Templates()...) {
+		u = u || t.Tree != nil && nodeUsesSite(t.Tree.Root)
+	}
+	styleUsesSite[style] = u
+	return u
+}
+
+func nodeUsesSite(n parse.Node) bool {
+	hasSite := func(idents []string) bool {
+		for _, id := range idents {
+			if id == "Site" {
+				return true
+			}
+		}
+		return false
+	}
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return false
+		}
+		for _, c := range n.Nodes {
+			if nodeUsesSite(c) {
+				return true
+			}
+		}
+	case *parse.ActionNode:
+		return nodeUsesSite(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return false
+		}
+		for _, c := range n.Cmds {
+			if nodeUsesSite(c) {
+				return true
+			}
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			if nodeUsesSite(a) {
+				return true
+			}
+		}
+	case *parse.FieldNode:
+		return hasSite(n.Ident)
+	case *parse.VariableNode:
+		return hasSite(n.Ident)
+	case *parse.ChainNode:
+		return nodeUsesSite(n.Node) || hasSite(n.Field)
+	case *parse.IfNode:
+		return nodeUsesSite(n.Pipe) || nodeUsesSite(n.List) || nodeUsesSite(n.ElseList)
+	case *parse.RangeNode:
+		return nodeUsesSite(n.Pipe) || nodeUsesSite(n.List) || nodeUsesSite(n.ElseList)
+	case *parse.WithNode:
+		return nodeUsesSite(n.Pipe) || nodeUsesSite(n.List) || nodeUsesSite(n.ElseList)
+	case *parse.TemplateNode:
+		return nodeUsesSite(n.Pipe)
+	}
+	return false
+}
+
+// Section returns the section whose Dir is dir, or nil.
+func (s *siteContext) Section(dir string) *sectionContext {
+	for _, sctx := range s.Sections {
+		if sctx.Dir == dir {
+			return sctx
+		}
+	}
+	return nil
+}
+
+// Latest returns the n latest items of every section.
+func (s *siteContext) Latest(n int) []*itemContext {
+	if n > len(s.Items) {
+		n = len(s.Items)
+	}
+	return s.Items[:n]
+}
+
+func (s *siteContext) RootURL() string {
+	return Config.BasePath
+}
+
+func (s *sectionContext) Site() *siteContext {
+	return site
+}
+func (t *tagContext) Site() *siteContext {
+	return site
+}
+func (i *itemContext) Site() *siteContext {
+	return site
+}
+func (t *taxonomyContext) Site() *siteContext {
+	return site
+}
+func (t *termContext) Site() *siteContext {
+	return site
+}
+func (a *archiveContext) Site() *siteContext {
+	return site
+}
+func (y *yearContext) Site() *siteContext {
+	return site
+}
+func (m *monthContext) Site() *siteContext {
+	return site
+}
+func (sc *shortcodeContext) Site() *siteContext {
+	return site
+}
@@ -0,0 +1,46 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	htpl "html/template"
+	"testing"
+)
+
+func TestNodeUsesSite(t *testing.T) {
+	tests := []struct {
+		tpl  string
+		uses bool
+	}{
+		{`{{.Title}}`, false},
+		{`{{.Site.Title}}`, true},
+		{`{{range .Site.Latest 5}}{{.Title}}{{end}}`, true},
+		{`{{with $s := .Site}}{{$s.Title}}{{end}}`, true},
+		{`{{if .Draft}}{{else}}{{(.Site.Section "blog").Title}}{{end}}`, true},
+		{`{{range .Related}}{{.Title}}{{end}}`, false},
+		{`{{template "x" .Site}}`, true},
+		{`{{$.Site.Title}}`, true},
+	}
+	for _, tt := range tests {
+		tpl, err := htpl.New("t").Funcs(htpl.FuncMap{}).Parse(tt.tpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := nodeUsesSite(tpl.Tree.Root); got != tt.uses {
+			t.Errorf("nodeUsesSite(%q) = %v, want %v", tt.tpl, got, tt.uses)
+		}
+	}
+}
@@ -20,7 +20,6 @@ import (
 	htpl "html/template"
 	"log"
 	"path/filepath"
-	"strings"
 	"time"
 )
 
@@ -30,18 +29,26 @@ var styleDef string = "default"
 var styleTpls = make(map[string]*htpl.Template)
 
 func stylePath(style string) string {
-	return cfgDir + "/" + stylesDir + "/" + style + "/"
+	return filepath.Join(cfgDir, stylesDir, style) + "/"
 }
 
-func newStyleTpl(style string) *htpl.Template {
-	mapFunc := htpl.FuncMap{
+func styleFuncs(style string) htpl.FuncMap {
+	return htpl.FuncMap{
 		"GetBody":     GetBody,
 		"Exec":        Exec,
 		"DateFormat":  DateFormat,
 		"SortItemsBy": SortItemsBy,
 		"RawHtml":     RawHtml,
+		"RelURL":      RelURL,
+		"AbsURL":      AbsURL,
+		"asset":       assetFunc(style),
+		"ref":         Ref,
+		"TOCHTML":     TOCHTML,
 	}
-	styletpl, err := htpl.New(style).Funcs(mapFunc).ParseGlob(stylePath(style) + "/" + "*.html")
+}
+
+func newStyleTpl(style string) *htpl.Template {
+	styletpl, err := htpl.New(style).Funcs(styleFuncs(style)).ParseGlob(stylePath(style) + "/" + "*.html")
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -73,28 +80,48 @@ func DateFormat(d *time.Time, layout string) string {
 	return (*d).Format(layout)
 }
 
+// usedStyles returns the styles used by the sections and, when pages not
+// belonging to any section are rendered, by the site.
+func usedStyles() []string {
+	var styles []string
+	seen := make(map[string]bool)
+	add := func(style string) {
+		if !seen[style] {
+			seen[style] = true
+			styles = append(styles, style)
+		}
+	}
+	for _, s := range AllSections {
+		add(s.Style)
+	}
+	if len(Config.Taxonomies) > 0 || Config.GlobalTags {
+		add(siteSection.Style)
+	}
+	return styles
+}
+
 // FIXME: copy assets, favicon, etc.
 
 func copyCss() {
-	for _, s := range AllSections {
-		fs, err := filepath.Glob(stylePath(s.Style) + "*.css")
+	for _, style := range usedStyles() {
+		fs, err := filepath.Glob(stylePath(style) + "*.css")
 		if err != nil {
 			log.Fatal(err)
 		}
 		for _, f := range fs {
-			copyFile(f, buildDir+"/css/"+strings.TrimPrefix(f, cfgDir+"/"+stylesDir+"/"))
+			copyFile(f, filepath.Join(buildDir, "css", style, filepath.Base(f)))
 		}
 	}
 }
 
 func copyJs() {
-	for _, s := range AllSections {
-		fs, err := filepath.Glob(stylePath(s.Style) + "*.js")
+	for _, style := range usedStyles() {
+		fs, err := filepath.Glob(stylePath(style) + "*.js")
 		if err != nil {
 			log.Fatal(err)
 		}
 		for _, f := range fs {
-			copyFile(f, buildDir+"/js/"+strings.TrimPrefix(f, cfgDir+"/"+stylesDir+"/"))
+			copyFile(f, filepath.Join(buildDir, "js", style, filepath.Base(f)))
 		}
 	}
 }
@@ -0,0 +1,118 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	moreMarker      = "<!--more-->"
+	summaryWordsDef = 70
+	wordsPerMinute  = 200
+)
+
+// Feeds and indexes need the text of every item on every build, also of
+// the items whose page is up to date. textsState keeps, inside the build
+// directory, the texts found by the last build, so that those items aren't
+// rendered again.
+const textsState = ".texts"
+
+type itemText struct {
+	Text    string // of the whole body
+	More    string `json:",omitempty"` // of the body up to moreMarker
+	HasMore bool   `json:",omitempty"`
+}
+
+var oldTexts, newTexts = make(map[string]*itemText), make(map[string]*itemText)
+
+func loadTextsState() {
+	b, err := ioutil.ReadFile(filepath.Join(buildDir, textsState))
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(b, &oldTexts)
+	if err != nil {
+		oldTexts = make(map[string]*itemText)
+	}
+}
+
+func saveTextsState() {
+	b, err := json.Marshal(newTexts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	writeFile(filepath.Join(buildDir, textsState), b)
+}
+
+// texts returns the texts of the body of i, rendering it only if the page of
+// i is out of date.
+func texts(i *item) *itemText {
+	if t, ok := newTexts[i.outpath]; ok {
+		return t
+	}
+	t, ok := oldTexts[i.outpath]
+	if !ok || i.rendered || i.needsUpdate() {
+		body := string(GetBody(i))
+		t = &itemText{Text: stripTags(body)}
+		if n := strings.Index(body, moreMarker); n >= 0 {
+			t.More, t.HasMore = stripTags(body[:n]), true
+		}
+	}
+	newTexts[i.outpath] = t
+	return t
+}
+
+// bodyText returns the text of the rendered body.
+func (ictx *itemContext) bodyText() string {
+	return texts(ictx.item).Text
+}
+
+// WordCount returns the number of words of the body.
+func (ictx *itemContext) WordCount() int {
+	return len(strings.Fields(ictx.bodyText()))
+}
+
+// ReadingTime returns the minutes needed to read the body.
+func (ictx *itemContext) ReadingTime() int {
+	w := ictx.WordCount()
+	if w == 0 {
+		return 0
+	}
+	return (w + wordsPerMinute - 1) / wordsPerMinute
+}
+
+// Summary returns the text of the body up to the <!--more--> marker or, if
+// there's no marker, its first SummaryWords words.
+func (ictx *itemContext) Summary() string {
+	t := texts(ictx.item)
+	if t.HasMore {
+		return t.More
+	}
+	n := ictx.item.r.s.SummaryWords
+	if n <= 0 {
+		n = summaryWordsDef
+	}
+	words := strings.Fields(t.Text)
+	if len(words) <= n {
+		return strings.Join(words, " ")
+	}
+	return strings.Join(words[:n], " ") + " …"
+}
@@ -0,0 +1,236 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/feeds"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Tags are compared by their slug, so `Go' and `go' are the same tag. The
+// site's `tagaliases' maps tags to the tag they stand for:
+//
+//	tagaliases:
+//	  golang: go
+//
+// Items keep, as the name of a tag, its first spelling found (aliases
+// aside); the slug names the tag's page. Only tags differing in case or
+// aliased merge: distinct tags with the same slug, like `web dev' and
+// `web-dev', are an error.
+var (
+	tagAliases = make(map[string]string) // slug -> slug
+	tagNames   = make(map[string]string) // slug -> name
+)
+
+func setTagAliases(aliases map[string]string) {
+	for from, to := range aliases {
+		if tagSlugify(from) == "" || tagSlugify(to) == "" {
+			log.Fatalf("tagaliases: empty tag in %q: %q", from, to)
+		}
+		tagAliases[tagSlugify(from)] = tagSlugify(to)
+		tagNames[tagSlugify(to)] = to
+	}
+}
+
+// tagSymbols spells out the symbols which slugify would drop but which tell
+// tags apart: C, C++ and C# are c, c-plus-plus and c-sharp.
+var tagSymbols = strings.NewReplacer("+", " plus ", "#", " sharp ", ".", " dot ")
+
+func tagSlugify(tag string) string {
+	return slugify(tagSymbols.Replace(tag))
+}
+
+// tagSlug returns the slug of tag, aliases resolved.
+func tagSlug(tag string) string {
+	s := tagSlugify(tag)
+	if a, ok := tagAliases[s]; ok {
+		return a
+	}
+	return s
+}
+
+// normalizeTags replaces the tags of every item with their names, merging
+// duplicates.
+func normalizeTags() {
+	seen := make(map[string]*item) // slug -> first item naming the tag
+	for _, s := range AllSections {
+		for _, i := range s.items {
+			for _, t := range i.Tags {
+				slug := tagSlug(t)
+				if slug == "" {
+					log.Fatalf("%s: tag %q has an empty slug", i.inpath, t)
+				}
+				if _, ok := tagAliases[tagSlugify(t)]; ok {
+					continue
+				}
+				if first, ok := seen[slug]; !ok {
+					tagNames[slug] = t
+					seen[slug] = i
+				} else if !strings.EqualFold(tagNames[slug], t) {
+					log.Fatalf("%s: tag %q has the same slug %q as tag %q of %s, add a `tagaliases' entry to merge them or rename one", i.inpath, t, slug, tagNames[slug], first.inpath)
+				}
+			}
+		}
+	}
+	for _, s := range AllSections {
+		for _, i := range s.items {
+			var tags []string
+			dup := make(map[string]bool)
+			for _, t := range i.Tags {
+				slug := tagSlug(t)
+				if !dup[slug] {
+					dup[slug] = true
+					tags = append(tags, tagNames[slug])
+				}
+			}
+			i.Tags = tags
+		}
+	}
+}
+
+// renderGlobalTags writes, if the site's `globaltags' is set, the tag pages
+// gathering the items of every section: /tags and /tag/<tag>. They use the
+// tag.html and tags.html templates of the site's style; every item keeps
+// the context of its own section. The URLs written are returned. A section
+// with dir `.' writes its own tag pages at the same paths, that's an error.
+func renderGlobalTags() []string {
+	if !Config.GlobalTags {
+		return nil
+	}
+	var urls []string
+	sctx := contextFromSection(siteSection)
+	sctx.Tags = globalTags(sctx)
+	for _, tctx := range sctx.Tags {
+		outputGlobalTags("tag.html", filepath.Join(buildDir, "tag", tctx.Slug+".html"), tctx)
+		urls = append(urls, tctx.AbsoluteURL())
+	}
+	sctx.TagsContext = true
+	outputGlobalTags("tags.html", filepath.Join(buildDir, "tags.html"), sctx)
+	urls = append(urls, sctx.AbsoluteURL())
+	sctx.TagsContext = false
+	return urls
+}
+
+func outputGlobalTags(tplname, outpath string, cx interface{}) {
+	if src, ok := producerOf(outpath); ok {
+		log.Fatalf("globaltags: %s is also written by %s, sections with dir `.' have their own tag pages", outpath, src)
+	}
+	outputTemplate(tplname, outpath, siteSection, cx)
+}
+
+// globalTags returns the tags of every section, each one with the items of
+// every section tagged with it.
+func globalTags(sctx *sectionContext) []*tagContext {
+	tags := make(map[string][]*item)
+	for _, s := range AllSections {
+		for _, i := range s.items {
+			for _, t := range i.Tags {
+				tags[t] = append(tags[t], i)
+			}
+		}
+	}
+	var tagnames []string
+	for k := range tags {
+		tagnames = append(tagnames, k)
+	}
+	sort.Slice(tagnames, func(i, j int) bool { return strings.ToLower(tagnames[i]) < strings.ToLower(tagnames[j]) })
+
+	var tctxs []*tagContext
+	for _, tagname := range tagnames {
+		items := tags[tagname]
+		SortItemsBy(items, strings.Split(siteSection.IndexSort, ",")...)
+		var is []*itemContext
+		for _, i := range items {
+			is = append(is, contextFromItemSection(i))
+		}
+		tctxs = append(tctxs, contextFromTag(tagname, is, sctx))
+	}
+	return tctxs
+}
+
+// tagMeta describes a tag. It comes from the section's `tagmeta' entry,
+// keyed by tag, or from <section>/tags/<tag>.yaml, which wins. The global
+// tag pages use the site's `tagmeta' and _formica/tags/ instead.
+type tagMeta struct {
+	Title       string
+	Description string
+	Image       string
+}
+
+const tagMetaDir = "tags"
+
+func readTagMetaDir(dir string) map[string]*tagMeta {
+	fs, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	m := make(map[string]*tagMeta)
+	for _, f := range fs {
+		buf, err := ioutil.ReadFile(f)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tm := &tagMeta{}
+		err = yaml.Unmarshal(buf, tm)
+		if err != nil {
+			log.Fatalf("%s: %v", f, err)
+		}
+		m[strings.TrimSuffix(filepath.Base(f), ".yaml")] = tm
+	}
+	return m
+}
+
+func (s *section) loadTagMeta(dir string) {
+	m := make(map[string]*tagMeta)
+	for t, tm := range s.TagMeta {
+		m[tagSlug(t)] = tm
+	}
+	for t, tm := range readTagMetaDir(dir) {
+		m[tagSlug(t)] = tm
+	}
+	s.TagMeta = m
+}
+
+func loadTagMeta() {
+	for _, s := range AllSections {
+		s.loadTagMeta(srcPath(filepath.Join(s.Dir, tagMetaDir)))
+	}
+	siteSection.loadTagMeta(filepath.Join(cfgDir, tagMetaDir))
+}
+
+func (s *section) tagMeta(slug string) *tagMeta {
+	return s.TagMeta[slug]
+}
+
+// outputTagFeeds writes the feeds of the items tagged with t.
+func outputTagFeeds(t *tagContext) {
+	p := strings.TrimPrefix(t.AbsoluteURL(), Config.BasePath)
+	feed := &feeds.Feed{
+		Title:       t.PageTitle(),
+		Link:        &feeds.Link{Href: t.AbsoluteURL()},
+		Description: t.Excerpt,
+	}
+	if t.Image != "" {
+		feed.Image = &feeds.Image{Url: AbsURL(t.Image), Title: t.PageTitle(), Link: AbsURL(p)}
+	}
+	writeFeeds(feed, t.Items, filepath.Join(buildDir, p), t.section.section)
+}
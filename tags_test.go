@@ -0,0 +1,38 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import "testing"
+
+func TestTagSlug(t *testing.T) {
+	tests := []struct {
+		tag, slug string
+	}{
+		{"Go", "go"},
+		{"C", "c"},
+		{"C++", "c-plus-plus"},
+		{"C#", "c-sharp"},
+		{"F#", "f-sharp"},
+		{".NET", "dot-net"},
+		{"Node.js", "node-dot-js"},
+		{"web dev", "web-dev"},
+	}
+	for _, tt := range tests {
+		if got := tagSlug(tt.tag); got != tt.slug {
+			t.Errorf("tagSlug(%q) = %q, want %q", tt.tag, got, tt.slug)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"fmt"
+	htpl "html/template"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/feeds"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// A taxonomy groups the items of every section by the terms found in the
+// item header field named Name. Declared in the site entry of the
+// configuration:
+//
+//	taxonomies:
+//	  - name: series
+//	    url: series/{term}     # default: <name>/{term}
+//	    list: series.html      # default: taxonomy.html
+//	    term: serie.html       # default: term.html
+//	    feed: true
+//	    data: data/series.yaml # default: data/<name>.yaml, if present
+//
+// The list page is written at <name>, each term page at URL. Data is a
+// file inside the configuration directory mapping terms to their metadata.
+type taxonomy struct {
+	Name      string
+	URL       string
+	List      string
+	Term      string
+	Feed      bool
+	Data      string
+	IndexSort string
+
+	meta  map[string]map[string]interface{}
+	terms map[string][]*item // term slug -> items
+	names map[string]string  // term slug -> term as first seen
+}
+
+// siteSection is the site entry of the configuration, it gives a style to
+// the pages not belonging to any section.
+var siteSection = &section{Style: styleDef}
+
+func checkTaxonomies(ts []*taxonomy) {
+	seen := make(map[string]bool)
+	for n, t := range ts {
+		if t.Name == "" {
+			log.Fatalf("no `name' specified for taxonomy n. %d", n+1)
+		}
+		if seen[t.Name] {
+			log.Fatalf("taxonomy %q declared twice", t.Name)
+		}
+		seen[t.Name] = true
+		if t.URL == "" {
+			t.URL = t.Name + "/{term}"
+		}
+		if !strings.Contains(t.URL, "{term}") {
+			log.Fatalf("taxonomy %q: `url' must contain {term}", t.Name)
+		}
+		t.URL = strings.Trim(t.URL, "/")
+		if t.List == "" {
+			t.List = "taxonomy.html"
+		}
+		if t.Term == "" {
+			t.Term = "term.html"
+		}
+		if t.IndexSort == "" {
+			t.IndexSort = "id"
+		}
+		t.terms = make(map[string][]*item)
+		t.names = make(map[string]string)
+		t.meta = readTermsMeta(t)
+	}
+}
+
+func readTermsMeta(t *taxonomy) map[string]map[string]interface{} {
+	p := t.Data
+	if p == "" {
+		p = filepath.Join("data", t.Name+".yaml")
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(cfgDir, p))
+	if err != nil {
+		if os.IsNotExist(err) && t.Data == "" {
+			return nil
+		}
+		log.Fatal(err)
+	}
+	m := make(map[string]map[string]interface{})
+	err = yaml.Unmarshal(buf, &m)
+	if err != nil {
+		log.Fatalf("%s: %v", p, err)
+	}
+	return m
+}
+
+// termsFromHeader extracts the taxonomy terms from the item header h.
+func termsFromHeader(i *item, h []byte) {
+	if len(Config.Taxonomies) == 0 {
+		return
+	}
+	m := make(map[string]interface{})
+	err := yaml.Unmarshal(h, &m)
+	if err != nil {
+		log.Fatalf("%s: %v", i.inpath, err)
+	}
+	for _, t := range Config.Taxonomies {
+		switch v := m[t.Name].(type) {
+		case nil:
+		case []interface{}:
+			for _, e := range v {
+				i.terms[t.Name] = append(i.terms[t.Name], fmt.Sprint(e))
+			}
+		default:
+			i.terms[t.Name] = append(i.terms[t.Name], fmt.Sprint(v))
+		}
+	}
+}
+
+// collectTerms groups the items of every section by term.
+func (t *taxonomy) collectTerms() {
+	for _, s := range AllSections {
+		for _, i := range s.items {
+			for _, term := range i.terms[t.Name] {
+				slug := slugify(term)
+				if _, ok := t.names[slug]; !ok {
+					t.names[slug] = term
+				}
+				t.terms[slug] = append(t.terms[slug], i)
+			}
+		}
+	}
+}
+
+func (t *taxonomy) termPath(slug string) string {
+	return strings.Replace(t.URL, "{term}", slug, -1)
+}
+
+type taxonomyContext struct {
+	Name  string
+	Terms []*termContext
+
+	taxonomy *taxonomy
+	site     *sectionContext
+}
+
+type termContext struct {
+	Term     string // as written in the first item using it
+	Slug     string
+	Items    []*itemContext
+	Meta     map[string]interface{}
+	Taxonomy *taxonomyContext
+}
+
+func (t *taxonomyContext) AbsoluteURL() string {
+	return RelURL(t.Name)
+}
+func (t *taxonomyContext) PageTitle() string {
+	return t.Name
+}
+func (t *taxonomyContext) FeedURL() string {
+	return ""
+}
+func (t *taxonomyContext) HomeURL() string {
+	return t.site.HomeURL()
+}
+func (t *taxonomyContext) RootURL() string {
+	return t.site.RootURL()
+}
+func (t *taxonomyContext) HomeTitle() string {
+	return t.site.HomeTitle()
+}
+func (t *taxonomyContext) Include() htpl.HTML {
+	return t.site.Include()
+}
+func (t *taxonomyContext) GoPath() string {
+	return ""
+}
+
+func (t *termContext) AbsoluteURL() string {
+	return RelURL(t.Taxonomy.taxonomy.termPath(t.Slug))
+}
+func (t *termContext) FeedURL() string {
+	if t.Taxonomy.taxonomy.Feed {
+		return t.AbsoluteURL() + atomPath
+	}
+	return ""
+}
+func (t *termContext) PageTitle() string {
+	if title, ok := t.Meta["title"].(string); ok {
+		return title
+	}
+	return t.Term + " - " + t.Taxonomy.Name
+}
+func (t *termContext) HomeURL() string {
+	return t.Taxonomy.HomeURL()
+}
+func (t *termContext) RootURL() string {
+	return t.Taxonomy.RootURL()
+}
+func (t *termContext) HomeTitle() string {
+	return t.Taxonomy.HomeTitle()
+}
+func (t *termContext) Include() htpl.HTML {
+	return t.Taxonomy.Include()
+}
+func (t *termContext) GoPath() string {
+	return ""
+}
+
+// renderTaxonomies writes the list and term pages of every taxonomy and
+// returns their URLs.
+func renderTaxonomies() []string {
+	var urls []string
+	site := contextFromSection(siteSection)
+	for _, t := range Config.Taxonomies {
+		t.collectTerms()
+		tctx := &taxonomyContext{Name: t.Name, taxonomy: t, site: site}
+		var slugs []string
+		for slug := range t.terms {
+			slugs = append(slugs, slug)
+		}
+		sort.Strings(slugs)
+		for _, slug := range slugs {
+			items := t.terms[slug]
+			SortItemsBy(items, strings.Split(t.IndexSort, ",")...)
+			termctx := &termContext{Term: t.names[slug], Slug: slug, Meta: t.meta[t.names[slug]], Taxonomy: tctx}
+			if termctx.Meta == nil {
+				termctx.Meta = t.meta[slug]
+			}
+			for _, i := range items {
+				termctx.Items = append(termctx.Items, contextFromItemSection(i))
+			}
+			tctx.Terms = append(tctx.Terms, termctx)
+		}
+		// every term page sees all the terms
+		for _, termctx := range tctx.Terms {
+			p := filepath.Join(buildDir, t.termPath(termctx.Slug))
+			outputTemplate(t.Term, p+".html", siteSection, termctx)
+			if t.Feed {
+				feed := &feeds.Feed{
+					Title: termctx.PageTitle(),
+					Link:  &feeds.Link{Href: termctx.AbsoluteURL()},
+				}
+				writeFeeds(feed, termctx.Items, p, siteSection)
+			}
+			urls = append(urls, termctx.AbsoluteURL())
+		}
+		outputTemplate(t.List, filepath.Join(buildDir, t.Name+".html"), siteSection, tctx)
+		urls = append(urls, tctx.AbsoluteURL())
+	}
+	return urls
+}
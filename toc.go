@@ -0,0 +1,95 @@
+/* Copyright (C) 2014, 2015 by Alexandru Cojocaru */
+
+/* This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"html"
+	htpl "html/template"
+	"strconv"
+	"strings"
+)
+
+const tocDepthDef = 3
+
+type tocEntry struct {
+	ID       string
+	Title    string
+	Level    int
+	Children []*tocEntry
+}
+
+// TOC returns the headings of the body, nested by level. Only the first
+// TOCDepth levels, counting from the topmost heading found, are included.
+func (ictx *itemContext) TOC() []*tocEntry {
+	var flat []*tocEntry
+	for _, m := range headingRe.FindAllSubmatch([]byte(GetBody(ictx.item)), -1) {
+		level, _ := strconv.Atoi(string(m[1]))
+		id := ""
+		if idm := idAttrRe.FindSubmatch(m[2]); idm != nil {
+			id = string(idm[1])
+		}
+		flat = append(flat, &tocEntry{ID: id, Title: strings.TrimSpace(stripTags(string(m[3]))), Level: level})
+	}
+	if len(flat) == 0 {
+		return nil
+	}
+
+	top := flat[0].Level
+	for _, e := range flat {
+		if e.Level < top {
+			top = e.Level
+		}
+	}
+	depth := ictx.item.r.s.TOCDepth
+	if depth <= 0 {
+		depth = tocDepthDef
+	}
+
+	var toc []*tocEntry
+	var stack []*tocEntry
+	for _, e := range flat {
+		if e.Level >= top+depth {
+			continue
+		}
+		for len(stack) > 0 && stack[len(stack)-1].Level >= e.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			toc = append(toc, e)
+		} else {
+			p := stack[len(stack)-1]
+			p.Children = append(p.Children, e)
+		}
+		stack = append(stack, e)
+	}
+	return toc
+}
+
+// TOCHTML renders toc as nested lists.
+func TOCHTML(toc []*tocEntry) htpl.HTML {
+	if len(toc) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("<ul>")
+	for _, e := range toc {
+		b.WriteString(`<li><a href="#` + html.EscapeString(e.ID) + `">` + html.EscapeString(e.Title) + "</a>")
+		b.WriteString(string(TOCHTML(e.Children)))
+		b.WriteString("</li>")
+	}
+	b.WriteString("</ul>")
+	return htpl.HTML(b.String())
+}